@@ -15,6 +15,7 @@ import (
 	"github.com/lillilli/graphex/config"
 	"github.com/lillilli/graphex/server"
 	"github.com/lillilli/graphex/watcher"
+	"github.com/lillilli/graphex/webhook"
 )
 
 var (
@@ -47,11 +48,34 @@ func startService(cfg *config.Config) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	watcher := watcher.New(cfg.WatchDir)
+	roots, err := watcher.NewRoots(cfg.WatchRoots(), cfg.Watcher)
+	if err != nil {
+		return errors.Wrap(err, "creating watcher failed")
+	}
+
+	virtual, err := watcher.NewVirtual(roots, cfg.Derived, cfg.Merged)
+	if err != nil {
+		return errors.Wrap(err, "creating virtual files failed")
+	}
+
+	alerting, err := watcher.NewAlerting(virtual, cfg.Alerts)
+	if err != nil {
+		return errors.Wrap(err, "creating alert rules failed")
+	}
+
+	dispatcher, err := webhook.NewDispatcher(cfg.Webhooks)
+	if err != nil {
+		return errors.Wrap(err, "creating webhooks failed")
+	}
+
+	watcher := watcher.NewTee(alerting, dispatcher.Dispatch)
+
 	if err := watcher.Start(ctx); err != nil {
 		return errors.Wrap(err, "watch fs failed")
 	}
 
+	dispatcher.Start(ctx)
+
 	server := server.NewServer(cfg, watcher)
 	if err := server.Start(); err != nil {
 		return errors.Wrap(err, "listen ws failed")
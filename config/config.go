@@ -1,6 +1,10 @@
 package config
 
-import "github.com/lillilli/logger"
+import (
+	"time"
+
+	"github.com/lillilli/logger"
+)
 
 // Config - service configuration
 type Config struct {
@@ -8,6 +12,17 @@ type Config struct {
 
 	FrontendDistPath string
 	WatchDir         string
+	Watcher          Watcher
+	Roots            []Root
+
+	// Derived - virtual files with series, computed over columns of source files
+	Derived []DerivedFile
+
+	// Merged - virtual files, which merge or join several source files
+	Merged []MergedFile
+
+	Alerts   Alerts
+	Webhooks Webhooks
 
 	Log logger.Params
 }
@@ -17,3 +32,165 @@ type WSServer struct {
 	Host string `default:"0.0.0.0"`
 	Port int    `default:"8081"`
 }
+
+// DefaultRootName - name of the root, created from WatchDir
+const DefaultRootName = "default"
+
+// WatchRoots - returns configured watch roots, WatchDir is used, if roots are not set
+func (c *Config) WatchRoots() []Root {
+	if len(c.Roots) != 0 {
+		return c.Roots
+	}
+
+	return []Root{{Name: DefaultRootName, Dir: c.WatchDir}}
+}
+
+// Root - named watch root, parser settings override the watcher ones
+type Root struct {
+	Name string
+	Dir  string
+
+	// Include - glob patterns of watched files, overrides the watcher ones, if it is set
+	Include []string
+	// Exclude - glob patterns of not watched files and dirs, added to the watcher ones
+	Exclude []string
+
+	Parsers []ParserRule
+	CSV     *CSVParser
+	TSV     *CSVParser
+	XAxis   *XAxis
+}
+
+// Watcher - watcher configuration
+type Watcher struct {
+	// Backend - file system events backend: fsnotify, poll or auto
+	// (poll for network file systems and fsnotify otherwise)
+	Backend string `default:"fsnotify"`
+	// PollInterval - dirs stat interval of the poll backend
+	PollInterval time.Duration `default:"2s"`
+
+	Parsers []ParserRule
+
+	// Include - gitignore-style patterns of watched files, all files with known format are watched, if it is empty
+	Include []string
+	// Exclude - gitignore-style patterns of not watched files and dirs,
+	// .graphexignore file in the root is applied after them
+	Exclude []string `default:".*,*.tmp,*.swp,*~"`
+
+	// MaxWarnings - max count of parse warnings, sent for the file update
+	MaxWarnings int `default:"100"`
+
+	// QuietPeriod - file update is sent, when there were no file events for this period
+	QuietPeriod time.Duration `default:"100ms"`
+	// MaxLatency - max delay of the file update during continuous file events
+	MaxLatency time.Duration `default:"1s"`
+
+	// CacheBudget - approximate memory size of parsed files cache in bytes
+	CacheBudget int64 `default:"268435456"`
+
+	CSV   CSVParser
+	TSV   CSVParser
+	XAxis XAxis
+}
+
+// ParserRule - binds files, matched by glob pattern, to parser format
+type ParserRule struct {
+	Pattern string
+	Format  string
+}
+
+// CSVParser - delimited files parser configuration,
+// empty delimiter means format default ("," for csv and tab for tsv)
+type CSVParser struct {
+	Delimiter string
+	Comment   string `default:"#"`
+}
+
+// XAxis - x values parsing configuration, time values are normalized to epoch milliseconds
+type XAxis struct {
+	// Type - x values type: auto (number or time string, detected by value), number,
+	// time (string, parsed by layouts), epoch_s or epoch_ms (unix time in seconds or milliseconds)
+	Type string `default:"auto"`
+	// Layouts - Go time layouts of time strings, RFC 3339 and ISO 8601 date and time are parsed, if it is empty
+	Layouts []string
+	// Location - time zone of time strings without zone offset
+	Location string `default:"UTC"`
+}
+
+// DerivedFile - virtual file with series, computed by expressions over columns of the source file,
+// source is the full file name (with root name, if several roots are configured) or glob pattern (first matched file is used)
+type DerivedFile struct {
+	Name   string
+	Source string
+	Series []DerivedSeries
+}
+
+// DerivedSeries - series, computed by expression, e.g. "rolling_mean(loss, 10)"
+type DerivedSeries struct {
+	Name string
+	Expr string
+}
+
+// MergedFile - virtual file, which merges sources by kind: concat, join (x-aligned outer join) or mean
+// (x-aligned element-wise mean of series with the same name), sources are full file names or glob patterns
+type MergedFile struct {
+	Name    string
+	Kind    string `default:"concat"`
+	Sources []string
+}
+
+// Alerts - alerting configuration
+type Alerts struct {
+	// LogFile - file, which fired and resolved alerts are appended to as JSON lines, alerts are not logged, if it is empty
+	LogFile string
+	// CheckInterval - interval of absence rules checks
+	CheckInterval time.Duration `default:"1s"`
+
+	Rules []AlertRule
+}
+
+// AlertRule - alert rule on series of files, matched by the full file name or glob pattern:
+// threshold (value is above or below limits), rate (change of value per x unit, per second for time x axis,
+// is above or below limits), absence (file is not updated for the duration) or band (value is out of
+// mean ± K standard deviations of the previous Window values)
+type AlertRule struct {
+	Name string
+	File string
+	// Series - name of the checked series, all series are checked, if it is empty
+	Series string
+	Type   string
+
+	Above *float64
+	Below *float64
+
+	For time.Duration
+
+	Window int
+	K      float64 `default:"3"`
+}
+
+// Webhooks - outbound webhooks configuration, failed deliveries are retried with exponential backoff
+// from MinBackoff to MaxBackoff and are appended to DeadLetterFile after the last retry
+type Webhooks struct {
+	Endpoints []WebhookEndpoint
+
+	Timeout    time.Duration `default:"10s"`
+	Retries    int           `default:"5"`
+	MinBackoff time.Duration `default:"1s"`
+	MaxBackoff time.Duration `default:"1m"`
+	// QueueSize - max count of not delivered events of the endpoint, new events are dead-lettered, if queue is full,
+	// the same count of dead letters is queued for writing, the rest ones are dropped and counted in the log
+	QueueSize int `default:"1000"`
+	// DeadLetterFile - file, which failed deliveries are appended to as JSON lines, they are dropped, if it is empty
+	DeadLetterFile string
+}
+
+// WebhookEndpoint - webhook URL with events filters: event types (CREATE, MODIFY, REMOVE or ALERT)
+// and file glob patterns, all events are sent, if filters are empty,
+// body is signed by HMAC-SHA256 with the secret, if it is set
+type WebhookEndpoint struct {
+	URL    string
+	Secret string
+	Events []string
+	Files  []string
+}
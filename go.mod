@@ -1,5 +1,7 @@
 module github.com/lillilli/graphex
 
+go 1.12
+
 require (
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-fsnotify/fsnotify v0.0.0-20180321022601-755488143dae // indirect
@@ -8,6 +10,7 @@ require (
 	github.com/gorilla/context v1.1.1 // indirect
 	github.com/gorilla/mux v1.6.2 // indirect
 	github.com/gorilla/websocket v1.4.0
+	github.com/klauspost/compress v1.10.3
 	github.com/lillilli/logger v0.0.0-20190312093536-8f249b316b4d
 	github.com/lillilli/vconf v0.0.0-20180502141108-a75c3f943e56
 	github.com/pkg/errors v0.8.0
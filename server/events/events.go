@@ -1,6 +1,17 @@
 package events
 
 const (
-	FileSubscribeEvent = "file_subscribe"
-	RootSubscribeEvent = "root_subscribe"
+	FileSubscribeEvent   = "file_subscribe"
+	FileUnsubscribeEvent = "file_unsubscribe"
+	RootSubscribeEvent   = "root_subscribe"
+	FileAppendEvent      = "file_append"
+	FileWarningsEvent    = "file_warnings"
+	RangeQueryEvent      = "range_query"
+	StatsSubscribeEvent  = "stats_subscribe"
+	VirtualDefineEvent   = "virtual_define"
+	VirtualRemoveEvent   = "virtual_remove"
+	AlertSubscribeEvent  = "alert_subscribe"
+	AlertDefineEvent     = "alert_define"
+	AlertRemoveEvent     = "alert_remove"
+	AlertEvent           = "alert"
 )
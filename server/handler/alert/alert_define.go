@@ -0,0 +1,76 @@
+package alert
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lillilli/graphex/config"
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// AlertDefineHandler - alert rule definition handler
+type AlertDefineHandler struct {
+	Watcher watcher.Watcher
+}
+
+// AlertDefineParams - alert rule: type (threshold, rate, absence or band) on series of files,
+// matched by the full file name or glob pattern, all series are checked, if series is not set
+type AlertDefineParams struct {
+	Name   string   `json:"name"`
+	File   string   `json:"file"`
+	Series string   `json:"series"`
+	Type   string   `json:"type"`
+	Above  *float64 `json:"above"`
+	Below  *float64 `json:"below"`
+	For    string   `json:"for"`
+	Window int      `json:"window"`
+	K      float64  `json:"k"`
+}
+
+// alertRulePayload - name of the defined or removed alert rule
+type alertRulePayload struct {
+	Name string `json:"name"`
+}
+
+func (h AlertDefineHandler) Handle(client *hub.Client, data []byte) {
+	params := &AlertDefineParams{}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		client.SendJSON(events.AlertDefineEvent, "parsing params failed")
+		return
+	}
+
+	alerting, ok := watcher.AsAlerting(h.Watcher)
+	if !ok {
+		client.SendJSON(events.AlertDefineEvent, "alerts are not supported")
+		return
+	}
+
+	rule := config.AlertRule{
+		Name:   params.Name,
+		File:   params.File,
+		Series: params.Series,
+		Type:   params.Type,
+		Above:  params.Above,
+		Below:  params.Below,
+		Window: params.Window,
+		K:      params.K,
+	}
+
+	if params.For != "" {
+		var err error
+		if rule.For, err = time.ParseDuration(params.For); err != nil {
+			client.SendJSON(events.AlertDefineEvent, "bad alert rule")
+			return
+		}
+	}
+
+	if err := alerting.DefineAlert(rule); err != nil {
+		client.SendJSON(events.AlertDefineEvent, "bad alert rule")
+		return
+	}
+
+	client.SendJSON(events.AlertDefineEvent, &alertRulePayload{Name: params.Name})
+}
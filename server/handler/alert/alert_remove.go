@@ -0,0 +1,41 @@
+package alert
+
+import (
+	"encoding/json"
+
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// AlertRemoveHandler - alert rule removal handler, firing alerts of the rule are resolved
+type AlertRemoveHandler struct {
+	Watcher watcher.Watcher
+}
+
+// AlertRemoveParams - name of the removed alert rule
+type AlertRemoveParams struct {
+	Name string `json:"name"`
+}
+
+func (h AlertRemoveHandler) Handle(client *hub.Client, data []byte) {
+	params := &AlertRemoveParams{}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		client.SendJSON(events.AlertRemoveEvent, "parsing params failed")
+		return
+	}
+
+	alerting, ok := watcher.AsAlerting(h.Watcher)
+	if !ok {
+		client.SendJSON(events.AlertRemoveEvent, "alerts are not supported")
+		return
+	}
+
+	if err := alerting.RemoveAlert(params.Name); err != nil {
+		client.SendJSON(events.AlertRemoveEvent, "unknown alert rule")
+		return
+	}
+
+	client.SendJSON(events.AlertRemoveEvent, &alertRulePayload{Name: params.Name})
+}
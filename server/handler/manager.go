@@ -2,7 +2,10 @@ package handler
 
 import (
 	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/handler/alert"
+	"github.com/lillilli/graphex/server/handler/query"
 	"github.com/lillilli/graphex/server/handler/subscribe"
+	"github.com/lillilli/graphex/server/handler/virtual"
 	"github.com/lillilli/graphex/server/hub"
 	"github.com/lillilli/graphex/watcher"
 )
@@ -30,8 +33,16 @@ func NewManager(emitter hub.EventEmitter, watcher watcher.Watcher) Manager {
 }
 
 func (m *manager) initializeHandlers() {
-	m.handlers[events.RootSubscribeEvent] = &subscribe.RootSubscribeHandler{Emitter: m.emitter, Watcher: m.watcher}
-	m.handlers[events.FileSubscribeEvent] = &subscribe.FileSubscribeHandler{Emitter: m.emitter, Watcher: m.watcher}
+	m.handlers[events.RootSubscribeEvent] = &subscribe.RootSubscribeHandler{Emitter: m.emitter}
+	m.handlers[events.FileSubscribeEvent] = &subscribe.FileSubscribeHandler{Emitter: m.emitter}
+	m.handlers[events.FileUnsubscribeEvent] = &subscribe.FileUnsubscribeHandler{Emitter: m.emitter}
+	m.handlers[events.StatsSubscribeEvent] = &subscribe.StatsSubscribeHandler{Emitter: m.emitter}
+	m.handlers[events.RangeQueryEvent] = &query.RangeQueryHandler{Watcher: m.watcher}
+	m.handlers[events.VirtualDefineEvent] = &virtual.VirtualDefineHandler{Watcher: m.watcher}
+	m.handlers[events.VirtualRemoveEvent] = &virtual.VirtualRemoveHandler{Watcher: m.watcher}
+	m.handlers[events.AlertSubscribeEvent] = &subscribe.AlertSubscribeHandler{Emitter: m.emitter}
+	m.handlers[events.AlertDefineEvent] = &alert.AlertDefineHandler{Watcher: m.watcher}
+	m.handlers[events.AlertRemoveEvent] = &alert.AlertRemoveHandler{Watcher: m.watcher}
 }
 
 // GetHander - returns handler by req type, if handler not exists it will return default handler
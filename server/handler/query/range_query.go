@@ -0,0 +1,63 @@
+package query
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// maxRangeWidth - max plot width of range query in pixels
+const maxRangeWidth = 16384
+
+// RangeQueryHandler - range query handler
+type RangeQueryHandler struct {
+	Watcher watcher.Watcher
+}
+
+// RangeQueryParams - range query params: x interval (both bounds are required) and plot width in pixels,
+// version sets points format (1 - first series only, 2 - all series)
+type RangeQueryParams struct {
+	FileName string  `json:"name"`
+	From     float64 `json:"from"`
+	To       float64 `json:"to"`
+	Width    int     `json:"width"`
+	Version  int     `json:"version"`
+}
+
+func (h RangeQueryHandler) Handle(client *hub.Client, data []byte) {
+	// missing bounds are left NaN, because json could not contain NaN values
+	params := &RangeQueryParams{Version: hub.LegacyVersion, From: math.NaN(), To: math.NaN()}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		client.SendJSON(events.RangeQueryEvent, "parsing params failed")
+		return
+	}
+
+	if !hub.SupportedVersion(params.Version) {
+		client.SendJSON(events.RangeQueryEvent, "unsupported version")
+		return
+	}
+
+	if params.Width <= 0 || params.Width > maxRangeWidth || !(params.From <= params.To) {
+		client.SendJSON(events.RangeQueryEvent, "bad range")
+		return
+	}
+
+	res, err := h.Watcher.RangeQuery(params.FileName, params.From, params.To, params.Width)
+	if cause := errors.Cause(err); cause == watcher.ErrOutsideWatchDir || cause == watcher.ErrUnknownRoot || cause == watcher.ErrUnknownVirtualFile {
+		client.SendJSON(events.RangeQueryEvent, "invalid file name")
+		return
+	}
+
+	if err != nil {
+		client.SendJSON(events.RangeQueryEvent, "reading file failed")
+		return
+	}
+
+	client.SendJSON(events.RangeQueryEvent, hub.RangePayload(params.FileName, res, params.Version))
+}
@@ -0,0 +1,16 @@
+package subscribe
+
+import (
+	"github.com/lillilli/graphex/server/hub"
+)
+
+// AlertSubscribeHandler - alerts subscribe handler, firing alerts are sent at once and then fired and resolved alerts
+type AlertSubscribeHandler struct {
+	Emitter hub.EventEmitter
+}
+
+func (h AlertSubscribeHandler) Handle(client *hub.Client, data []byte) {
+	// repeated subscription does not duplicate alerts
+	h.Emitter.RemoveSubscriberForAlerts(client)
+	h.Emitter.AddSubscriberForAlerts(client)
+}
@@ -2,6 +2,9 @@ package subscribe
 
 import (
 	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/lillilli/graphex/server/events"
 	"github.com/lillilli/graphex/server/hub"
@@ -10,30 +13,101 @@ import (
 
 // FileSubscribeHandler - file subscribe handler
 type FileSubscribeHandler struct {
-	Watcher watcher.Watcher
 	Emitter hub.EventEmitter
 }
 
+// FileSubscribeParams - file subscribe params,
+// id identifies the subscription in file messages (subscription with the same id is replaced),
+// version sets messages format (1 - first series only, 2 - all series),
+// only the last points are sent, if window is set,
+// file data is reduced to about max points (if it is set) by downsampling method (lttb, minmax or nth)
 type FileSubscribeParams struct {
-	FileName string `json:"name"`
+	ID           string        `json:"id"`
+	FileName     string        `json:"name"`
+	Version      int           `json:"version"`
+	Window       *WindowParams `json:"window"`
+	MaxPoints    int           `json:"max_points"`
+	Downsampling string        `json:"downsampling"`
+}
+
+// WindowParams - subscription window: last points count and/or x span of the last points,
+// span could be set as duration (e.g. "15m") for time x axis
+type WindowParams struct {
+	Points   int     `json:"points"`
+	X        float64 `json:"x"`
+	Duration string  `json:"duration"`
+}
+
+// newWindow - returns subscription window by params
+func newWindow(params *WindowParams) (*watcher.Window, error) {
+	span := params.X
+
+	if params.Duration != "" {
+		if span != 0 {
+			return nil, errors.New("both x and duration are set")
+		}
+
+		duration, err := time.ParseDuration(params.Duration)
+		if err != nil {
+			return nil, err
+		}
+
+		span = float64(duration) / float64(time.Millisecond)
+	}
+
+	return watcher.NewWindow(params.Points, span)
 }
 
 func (h FileSubscribeHandler) Handle(client *hub.Client, data []byte) {
-	params := new(FileSubscribeParams)
+	params := &FileSubscribeParams{Version: hub.LegacyVersion}
 
-	if err := json.Unmarshal(data, &params); err != nil {
+	if err := json.Unmarshal(data, params); err != nil {
 		client.SendJSON(events.FileSubscribeEvent, "parsing params failed")
 		return
 	}
 
-	b, err := h.Watcher.FileState(params.FileName)
-	if err != nil {
-		client.SendJSON(events.FileSubscribeEvent, "reading file failed")
+	if !hub.SupportedVersion(params.Version) {
+		client.SendJSON(events.FileSubscribeEvent, "unsupported version")
+		return
+	}
+
+	var window *watcher.Window
+
+	if params.Window != nil {
+		var err error
+		if window, err = newWindow(params.Window); err != nil {
+			client.SendJSON(events.FileSubscribeEvent, "bad window params")
+			return
+		}
+	}
+
+	var downsampler *watcher.Downsampler
+
+	if params.MaxPoints != 0 || params.Downsampling != "" {
+		var err error
+		if downsampler, err = watcher.NewDownsampler(params.Downsampling, params.MaxPoints); err != nil {
+			client.SendJSON(events.FileSubscribeEvent, "bad downsampling params")
+			return
+		}
+	}
+
+	sub := &hub.Subscription{
+		ID:          params.ID,
+		File:        params.FileName,
+		Version:     params.Version,
+		Window:      window,
+		Downsampler: downsampler,
+		Client:      client,
+	}
+
+	// previous subscription with the same id is kept, if the new one fails
+	err := h.Emitter.AddSubscriberForFile(sub)
+	if cause := errors.Cause(err); cause == watcher.ErrOutsideWatchDir || cause == watcher.ErrUnknownRoot || cause == watcher.ErrUnknownVirtualFile {
+		client.SendJSON(events.FileSubscribeEvent, "invalid file name")
 		return
 	}
 
-	h.Emitter.RemoveSubscriberForFile(client.CurrentFile, client)
-	h.Emitter.AddSubscriberForFile(params.FileName, client)
-	client.SendJSON(events.FileSubscribeEvent, b)
-	client.CurrentFile = params.FileName
+	if err != nil {
+		client.SendJSON(events.FileSubscribeEvent, "reading file failed")
+	}
 }
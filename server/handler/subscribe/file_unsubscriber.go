@@ -0,0 +1,38 @@
+package subscribe
+
+import (
+	"encoding/json"
+
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+)
+
+// FileUnsubscribeHandler - file unsubscribe handler
+type FileUnsubscribeHandler struct {
+	Emitter hub.EventEmitter
+}
+
+// FileUnsubscribeParams - file unsubscribe params, id of the file subscription (empty for the default one)
+type FileUnsubscribeParams struct {
+	ID string `json:"id"`
+}
+
+func (h FileUnsubscribeHandler) Handle(client *hub.Client, data []byte) {
+	params := &FileUnsubscribeParams{}
+
+	if len(data) != 0 {
+		if err := json.Unmarshal(data, params); err != nil {
+			client.SendJSON(events.FileUnsubscribeEvent, "parsing params failed")
+			return
+		}
+	}
+
+	sub, ok := client.Unsubscribe(params.ID)
+	if !ok {
+		client.SendJSON(events.FileUnsubscribeEvent, "unknown subscription")
+		return
+	}
+
+	h.Emitter.RemoveSubscriberForFile(sub)
+	client.SendJSON(events.FileUnsubscribeEvent, hub.UnsubscribePayload(sub.ID))
+}
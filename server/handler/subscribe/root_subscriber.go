@@ -1,18 +1,42 @@
 package subscribe
 
 import (
+	"encoding/json"
+
 	"github.com/lillilli/graphex/server/events"
 	"github.com/lillilli/graphex/server/hub"
-	"github.com/lillilli/graphex/watcher"
 )
 
 // RootSubscribeHandler - root subscribe handler
 type RootSubscribeHandler struct {
-	Watcher watcher.Watcher
 	Emitter hub.EventEmitter
 }
 
+// RootSubscribeParams - root subscribe params,
+// version sets messages format (1 - flat list of file names, 2 - files grouped by roots, 3 - files metadata grouped by roots)
+type RootSubscribeParams struct {
+	Version int `json:"version"`
+}
+
 func (h RootSubscribeHandler) Handle(client *hub.Client, data []byte) {
-	h.Emitter.RemoveSubscriberForFile(client.CurrentFile, client)
-	client.SendJSON(events.RootSubscribeEvent, h.Watcher.State)
+	params := &RootSubscribeParams{Version: hub.LegacyRootVersion}
+
+	if len(data) != 0 {
+		if err := json.Unmarshal(data, params); err != nil {
+			client.SendJSON(events.RootSubscribeEvent, "parsing params failed")
+			return
+		}
+	}
+
+	if !hub.SupportedRootVersion(params.Version) {
+		client.SendJSON(events.RootSubscribeEvent, "unsupported version")
+		return
+	}
+
+	// legacy clients return to the files list from the file, so their default subscription is removed
+	if sub, ok := client.Unsubscribe(""); ok {
+		h.Emitter.RemoveSubscriberForFile(sub)
+	}
+
+	h.Emitter.SetRootVersion(client, params.Version)
 }
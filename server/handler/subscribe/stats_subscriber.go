@@ -0,0 +1,65 @@
+package subscribe
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// StatsSubscribeHandler - file statistics subscribe handler
+type StatsSubscribeHandler struct {
+	Emitter hub.EventEmitter
+}
+
+// StatsSubscribeParams - file statistics subscribe params,
+// default percentiles are used, if they are not set (empty list disables them)
+type StatsSubscribeParams struct {
+	FileName    string           `json:"name"`
+	Percentiles []float64        `json:"percentiles"`
+	Histogram   *HistogramParams `json:"histogram"`
+}
+
+// HistogramParams - histogram bins count and range, range is the series values range, if it is not set
+type HistogramParams struct {
+	Bins int      `json:"bins"`
+	Min  *float64 `json:"min"`
+	Max  *float64 `json:"max"`
+}
+
+func (h StatsSubscribeHandler) Handle(client *hub.Client, data []byte) {
+	params := &StatsSubscribeParams{Histogram: &HistogramParams{}}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		client.SendJSON(events.StatsSubscribeEvent, "parsing params failed")
+		return
+	}
+
+	if params.Percentiles == nil {
+		params.Percentiles = watcher.DefaultPercentiles
+	}
+
+	if params.Histogram == nil {
+		params.Histogram = &HistogramParams{}
+	}
+
+	opts, err := watcher.NewStatsOptions(params.Percentiles, params.Histogram.Bins, params.Histogram.Min, params.Histogram.Max)
+	if err != nil {
+		client.SendJSON(events.StatsSubscribeEvent, "bad stats params")
+		return
+	}
+
+	// previous subscription is kept, if the new one fails
+	err = h.Emitter.AddSubscriberForStats(params.FileName, opts, client)
+	if cause := errors.Cause(err); cause == watcher.ErrOutsideWatchDir || cause == watcher.ErrUnknownRoot || cause == watcher.ErrUnknownVirtualFile {
+		client.SendJSON(events.StatsSubscribeEvent, "invalid file name")
+		return
+	}
+
+	if err != nil {
+		client.SendJSON(events.StatsSubscribeEvent, "reading file failed")
+	}
+}
@@ -0,0 +1,69 @@
+package virtual
+
+import (
+	"encoding/json"
+
+	"github.com/lillilli/graphex/config"
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// DerivedKind - kind of virtual file with series, computed by expressions over the source file columns
+const DerivedKind = "derived"
+
+// VirtualDefineHandler - virtual file definition handler
+type VirtualDefineHandler struct {
+	Watcher watcher.Watcher
+}
+
+// VirtualDefineParams - virtual file definition: kind (concat, join, mean or derived),
+// source file names or glob patterns for merges, source file and series expressions for derived files
+type VirtualDefineParams struct {
+	Name    string         `json:"name"`
+	Kind    string         `json:"kind"`
+	Sources []string       `json:"sources"`
+	Source  string         `json:"source"`
+	Series  []SeriesParams `json:"series"`
+}
+
+// SeriesParams - derived series name and expression
+type SeriesParams struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+func (h VirtualDefineHandler) Handle(client *hub.Client, data []byte) {
+	params := &VirtualDefineParams{}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		client.SendJSON(events.VirtualDefineEvent, "parsing params failed")
+		return
+	}
+
+	files, ok := watcher.AsVirtualFiles(h.Watcher)
+	if !ok {
+		client.SendJSON(events.VirtualDefineEvent, "virtual files are not supported")
+		return
+	}
+
+	var err error
+
+	if params.Kind == DerivedKind {
+		cfg := config.DerivedFile{Name: params.Name, Source: params.Source}
+		for _, series := range params.Series {
+			cfg.Series = append(cfg.Series, config.DerivedSeries{Name: series.Name, Expr: series.Expr})
+		}
+
+		err = files.DefineDerived(cfg)
+	} else {
+		err = files.DefineMerged(config.MergedFile{Name: params.Name, Kind: params.Kind, Sources: params.Sources})
+	}
+
+	if err != nil {
+		client.SendJSON(events.VirtualDefineEvent, "bad virtual file definition")
+		return
+	}
+
+	client.SendJSON(events.VirtualDefineEvent, hub.VirtualPayload(params.Name))
+}
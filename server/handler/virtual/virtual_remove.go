@@ -0,0 +1,41 @@
+package virtual
+
+import (
+	"encoding/json"
+
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/server/hub"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// VirtualRemoveHandler - virtual file removal handler
+type VirtualRemoveHandler struct {
+	Watcher watcher.Watcher
+}
+
+// VirtualRemoveParams - name of the virtual file without the virtual root name
+type VirtualRemoveParams struct {
+	Name string `json:"name"`
+}
+
+func (h VirtualRemoveHandler) Handle(client *hub.Client, data []byte) {
+	params := &VirtualRemoveParams{}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		client.SendJSON(events.VirtualRemoveEvent, "parsing params failed")
+		return
+	}
+
+	files, ok := watcher.AsVirtualFiles(h.Watcher)
+	if !ok {
+		client.SendJSON(events.VirtualRemoveEvent, "virtual files are not supported")
+		return
+	}
+
+	if err := files.RemoveVirtual(params.Name); err != nil {
+		client.SendJSON(events.VirtualRemoveEvent, "unknown virtual file")
+		return
+	}
+
+	client.SendJSON(events.VirtualRemoveEvent, hub.VirtualPayload(params.Name))
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/lillilli/logger"
+
+	"github.com/lillilli/graphex/watcher"
 )
 
 const (
@@ -24,6 +26,9 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
+	// Messages, queued for sending to the peer. Connection of the peer, which does not read them, is closed.
+	sendQueueSize = 256
+
 	// Common error messages event
 	errorMessageType = "error"
 
@@ -48,9 +53,18 @@ type Client struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	CurrentFile string
+	RootVersion int
+
+	// subscriptions - file subscriptions by their ids
+	subscriptions     map[string]*Subscription
+	subscriptionsLock sync.Mutex
+
+	// StatsFile - file, which statistics the client is subscribed to
+	StatsFile    string
+	StatsOptions *watcher.StatsOptions
 
 	disconnected bool
+	overflowOnce sync.Once
 	log          logger.Logger
 	sync.RWMutex
 }
@@ -64,11 +78,14 @@ func NewClient(hub *Hub, conn *websocket.Conn, log logger.Logger) *Client {
 		hub:          hub,
 		conn:         conn,
 		events:       make(chan *IncomingMessage),
-		writeChannel: make(chan interface{}),
+		writeChannel: make(chan interface{}, sendQueueSize),
 
 		ctx:    ctx,
 		cancel: cancel,
 
+		RootVersion:   LegacyRootVersion,
+		subscriptions: make(map[string]*Subscription),
+
 		log: log,
 	}
 }
@@ -166,20 +183,36 @@ func (c *Client) sendBadEventDataFormat(req []byte) {
 	defer c.RUnlock()
 
 	errMsg := "bad event data format"
-	c.writeChannel <- &OutgoingResultMessage{Type: errorMessageType, Success: false, Request: req, ErrorMsg: errMsg}
+	c.enqueue(&OutgoingResultMessage{Type: errorMessageType, Success: false, Request: req, ErrorMsg: errMsg})
 }
 
-// SendJSON - send json msg to client
+// SendJSON - queues json msg for sending to client, messages are sent in the order of queueing
 func (c *Client) SendJSON(msgType string, v interface{}) {
 	if c.Disconnected() {
 		return
 	}
 
 	c.RLock()
-	c.writeChannel <- &OutgoingMessage{msgType, v}
-	c.RUnlock()
+	defer c.RUnlock()
 
-	time.Sleep(1 * time.Millisecond)
+	c.enqueue(&OutgoingMessage{msgType, v})
+}
+
+// enqueue - queues msg without blocking, connection is closed, if the queue is full,
+// so the slow client is disconnected by the read pump and does not block senders; read lock should be held
+func (c *Client) enqueue(msg interface{}) {
+	if c.disconnected {
+		return
+	}
+
+	select {
+	case c.writeChannel <- msg:
+	default:
+		c.overflowOnce.Do(func() {
+			c.log.Warnf("Send queue of %s is full, closing connection", c.conn.RemoteAddr())
+			c.conn.Close()
+		})
+	}
 }
 
 func (c *Client) setPingHandler() {
@@ -228,3 +261,38 @@ func (c *Client) Disconnected() bool {
 
 	return c.disconnected
 }
+
+// Subscribe - adds file subscription, returns the previous subscription with the same id, if it exists
+func (c *Client) Subscribe(sub *Subscription) (*Subscription, bool) {
+	c.subscriptionsLock.Lock()
+	defer c.subscriptionsLock.Unlock()
+
+	prev, ok := c.subscriptions[sub.ID]
+	c.subscriptions[sub.ID] = sub
+
+	return prev, ok
+}
+
+// Unsubscribe - removes file subscription by id, returns false, if there is no such subscription
+func (c *Client) Unsubscribe(id string) (*Subscription, bool) {
+	c.subscriptionsLock.Lock()
+	defer c.subscriptionsLock.Unlock()
+
+	sub, ok := c.subscriptions[id]
+	delete(c.subscriptions, id)
+
+	return sub, ok
+}
+
+// Subscriptions - returns file subscriptions of the client
+func (c *Client) Subscriptions() []*Subscription {
+	c.subscriptionsLock.Lock()
+	defer c.subscriptionsLock.Unlock()
+
+	subs := make([]*Subscription, 0, len(c.subscriptions))
+	for _, sub := range c.subscriptions {
+		subs = append(subs, sub)
+	}
+
+	return subs
+}
@@ -16,35 +16,58 @@ type EventEmitter interface {
 	Start(ctx context.Context)
 
 	AddSubscriberForRoot(client *Client)
-	AddSubscriberForFile(fileName string, client *Client)
+	SetRootVersion(client *Client, version int)
+	AddSubscriberForFile(sub *Subscription) error
+	AddSubscriberForStats(fileName string, opts *watcher.StatsOptions, client *Client) error
+	AddSubscriberForAlerts(client *Client)
 
 	RemoveSubscriberForRoot(client *Client)
-	RemoveSubscriberForFile(fileName string, client *Client)
+	RemoveSubscriberForFile(sub *Subscription)
+	RemoveSubscriberForStats(client *Client)
+	RemoveSubscriberForAlerts(client *Client)
 }
 
 type eventEmitter struct {
 	watcher watcher.Watcher
 
-	subscribersOnRoot []*Client
-	subscribersOnFile map[string][]*Client
+	subscribersOnRoot   []*Client
+	subscribersOnFile   map[string][]*Subscription
+	subscribersOnAlerts []*Client
+
+	// rootUpdates - signals the root updates sender, that watcher state is changed, changes, which are made
+	// during the sending, are coalesced into one pending update, rootMinVersion - min root messages version
+	// of the pending update subscribers (zero, if there is no pending update)
+	rootUpdates    chan struct{}
+	rootMinVersion int
+
+	// stats - statistics of files with stats subscribers, it is updated by file events
+	subscribersOnStats map[string][]*Client
+	stats              map[string]*watcher.Stats
 
 	log logger.Logger
 	sync.Mutex
 }
 
 // NewEventEmitter - return new hub event emitter instance
-func NewEventEmitter(watcher watcher.Watcher) EventEmitter {
+func NewEventEmitter(w watcher.Watcher) EventEmitter {
 	return &eventEmitter{
-		watcher:           watcher,
-		subscribersOnRoot: make([]*Client, 0),
-		subscribersOnFile: make(map[string][]*Client),
-		log:               logger.NewLogger("hub event emitter"),
+		watcher:             w,
+		subscribersOnRoot:   make([]*Client, 0),
+		subscribersOnFile:   make(map[string][]*Subscription),
+		rootUpdates:         make(chan struct{}, 1),
+		subscribersOnAlerts: make([]*Client, 0),
+
+		subscribersOnStats: make(map[string][]*Client),
+		stats:              make(map[string]*watcher.Stats),
+
+		log: logger.NewLogger("hub event emitter"),
 	}
 }
 
 func (e *eventEmitter) Start(ctx context.Context) {
 	e.log.Info("Starting ...")
 	go e.startEmitFileUpdates(ctx)
+	go e.startEmitRootUpdates(ctx)
 }
 
 func (e *eventEmitter) startEmitFileUpdates(ctx context.Context) {
@@ -55,29 +78,102 @@ func (e *eventEmitter) startEmitFileUpdates(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case data := <-updatesChannel:
+			if data.Type == watcher.AlertState {
+				e.sendAlert(data.Alert)
+				continue
+			}
+
 			if data.Type == watcher.CreateState || data.Type == watcher.RemoveState {
-				go e.sendEventForRoot()
+				e.updateRoot(LegacyRootVersion)
 				continue
 			}
 
+			// file updates are queued to clients synchronously, so appends are delivered in order
 			if data.Type == watcher.ModifyState {
-				go e.sendEventForFile(data)
+				e.sendEventForFile(events.FileSubscribeEvent, data)
+			}
+
+			if data.Type == watcher.AppendState {
+				e.sendEventForFile(events.FileAppendEvent, data)
 			}
+
+			e.sendStatsForFile(data)
+
+			// files metadata is changed with content
+			e.updateRoot(ListingVersion)
+		}
+	}
+}
+
+// updateRoot - queues sending of watcher state to root subscribers with messages version not less than minVersion
+func (e *eventEmitter) updateRoot(minVersion int) {
+	e.Lock()
+	if e.rootMinVersion == 0 || minVersion < e.rootMinVersion {
+		e.rootMinVersion = minVersion
+	}
+	e.Unlock()
+
+	select {
+	case e.rootUpdates <- struct{}{}:
+	default:
+	}
+}
+
+// startEmitRootUpdates - sends queued root updates one by one, so root messages are sent in order
+// and file events are not delayed by building of files listing
+func (e *eventEmitter) startEmitRootUpdates(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.rootUpdates:
+			e.sendEventForRoot()
 		}
 	}
 }
 
+// sendEventForRoot - sends watcher state to root subscribers of the pending update, payload is built once
+// for every version without the emitter lock, subscribers, which changed version during the building,
+// have already received the state in the new version
 func (e *eventEmitter) sendEventForRoot() {
 	e.Lock()
 
+	minVersion := e.rootMinVersion
+	e.rootMinVersion = 0
+
+	// signal of the update, which is already sent with the previous one
+	if minVersion == 0 {
+		e.Unlock()
+		return
+	}
+
+	versions := make(map[*Client]int)
 	for _, client := range e.subscribersOnRoot {
-		client.SendJSON(events.RootSubscribeEvent, e.watcher.State())
+		if client.RootVersion >= minVersion {
+			versions[client] = client.RootVersion
+		}
 	}
 
 	e.Unlock()
+
+	payloads := make(map[int]interface{})
+	for _, version := range versions {
+		if _, ok := payloads[version]; !ok {
+			payloads[version] = RootPayload(e.watcher, version)
+		}
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	for _, client := range e.subscribersOnRoot {
+		if version, ok := versions[client]; ok && version == client.RootVersion {
+			client.SendJSON(events.RootSubscribeEvent, payloads[version])
+		}
+	}
 }
 
-func (e *eventEmitter) sendEventForFile(data *watcher.Event) {
+func (e *eventEmitter) sendEventForFile(eventType string, data *watcher.Event) {
 	e.Lock()
 	defer e.Unlock()
 
@@ -86,28 +182,171 @@ func (e *eventEmitter) sendEventForFile(data *watcher.Event) {
 		return
 	}
 
-	for _, client := range subscribers {
-		client.SendJSON(events.FileSubscribeEvent, data.Values)
+	var (
+		full    *watcher.FileData
+		fullErr error
+	)
+
+	for _, sub := range subscribers {
+		if data.Values.Version <= sub.dataVersion {
+			continue
+		}
+
+		if eventType == events.FileAppendEvent && !sub.Appends() {
+			// the whole file is read once for all of subscribers, which do not handle appends
+			if full == nil && fullErr == nil {
+				if full, fullErr = e.watcher.FileState(data.Name); fullErr != nil {
+					e.log.Warnf("Reading file %q for subscribers failed: %v", data.Name, fullErr)
+				}
+			}
+
+			// subscriber receives the file with the next event, as its data version is not changed
+			if fullErr != nil {
+				continue
+			}
+
+			payload, _ := sub.Payload(full, false)
+			sub.Client.SendJSON(events.FileSubscribeEvent, payload)
+			sub.dataVersion = full.Version
+		} else if payload, ok := sub.Payload(data.Values, eventType == events.FileAppendEvent); ok {
+			sub.Client.SendJSON(eventType, payload)
+			sub.dataVersion = data.Values.Version
+		}
+
+		if data.Values.WarningsCount > 0 {
+			sub.Client.SendJSON(events.FileWarningsEvent, sub.WarningsPayload(data.Values))
+		}
+	}
+}
+
+// sendAlert - sends fired or resolved alert to alert subscribers
+func (e *eventEmitter) sendAlert(alert *watcher.Alert) {
+	e.Lock()
+	defer e.Unlock()
+
+	for _, client := range e.subscribersOnAlerts {
+		client.SendJSON(events.AlertEvent, alert)
+	}
+}
+
+// sendStatsForFile - updates file statistics by the file event and sends it to stats subscribers
+func (e *eventEmitter) sendStatsForFile(data *watcher.Event) {
+	e.Lock()
+	defer e.Unlock()
+
+	stats, ok := e.stats[data.Name]
+	if !ok {
+		return
+	}
+
+	if data.Type == watcher.AppendState {
+		if !stats.Add(data.Values) {
+			return
+		}
+	} else {
+		if data.Values.Version <= stats.Version() {
+			return
+		}
+
+		stats.Reset(data.Values)
+	}
+
+	for _, client := range e.subscribersOnStats[data.Name] {
+		client.SendJSON(events.StatsSubscribeEvent, StatsPayload(data.Name, stats.Get(client.StatsOptions)))
 	}
 }
 
 func (e *eventEmitter) AddSubscriberForRoot(client *Client) {
 	e.Lock()
+	defer e.Unlock()
+
 	e.subscribersOnRoot = append(e.subscribersOnRoot, client)
-	e.Unlock()
+	client.SendJSON(events.RootSubscribeEvent, RootPayload(e.watcher, client.RootVersion))
+}
+
+// SetRootVersion - sets root messages version of the client and sends it the watcher state in this version,
+// version is set under the emitter lock, as root messages are built by it
+func (e *eventEmitter) SetRootVersion(client *Client, version int) {
+	e.Lock()
+	defer e.Unlock()
 
-	client.SendJSON(events.RootSubscribeEvent, e.watcher.State())
+	client.RootVersion = version
+	client.SendJSON(events.RootSubscribeEvent, RootPayload(e.watcher, version))
 }
 
-func (e *eventEmitter) AddSubscriberForFile(fileName string, client *Client) {
+// AddSubscriberForFile - adds file subscription of the client, replacing its subscription with the same id,
+// and sends it the current file data, file data is read under the emitter lock, so no events are missed
+// between the reading and the subscription, events with the sent data version are skipped
+func (e *eventEmitter) AddSubscriberForFile(sub *Subscription) error {
 	e.Lock()
+	defer e.Unlock()
 
-	if _, ok := e.subscribersOnFile[fileName]; !ok {
-		e.subscribersOnFile[fileName] = make([]*Client, 0)
+	data, err := e.watcher.FileState(sub.File)
+	if err != nil {
+		return err
 	}
 
-	e.subscribersOnFile[fileName] = append(e.subscribersOnFile[fileName], client)
-	e.Unlock()
+	if prev, ok := sub.Client.Subscribe(sub); ok {
+		e.removeSubscriberForFile(prev)
+	}
+
+	e.subscribersOnFile[sub.File] = append(e.subscribersOnFile[sub.File], sub)
+	sub.dataVersion = data.Version
+
+	payload, _ := sub.Payload(data, false)
+	sub.Client.SendJSON(events.FileSubscribeEvent, payload)
+
+	if data.WarningsCount > 0 {
+		sub.Client.SendJSON(events.FileWarningsEvent, sub.WarningsPayload(data))
+	}
+
+	return nil
+}
+
+// AddSubscriberForStats - subscribes client for the file statistics with the options, replacing its previous
+// stats subscription, and sends it the current statistics, file data is read under the emitter lock,
+// so no events are missed between the reading and the subscription, previous subscription is kept on error
+func (e *eventEmitter) AddSubscriberForStats(fileName string, opts *watcher.StatsOptions, client *Client) error {
+	e.Lock()
+	defer e.Unlock()
+
+	data, err := e.watcher.FileState(fileName)
+	if err != nil {
+		return err
+	}
+
+	e.removeSubscriberForStats(client, client.StatsFile != fileName)
+
+	stats, ok := e.stats[fileName]
+	if !ok {
+		stats = watcher.NewStats(data)
+		e.stats[fileName] = stats
+	} else if stats.Version() < data.Version {
+		stats.Reset(data)
+	}
+
+	client.StatsFile = fileName
+	client.StatsOptions = opts
+
+	e.subscribersOnStats[fileName] = append(e.subscribersOnStats[fileName], client)
+	client.SendJSON(events.StatsSubscribeEvent, StatsPayload(fileName, stats.Get(opts)))
+
+	return nil
+}
+
+// AddSubscriberForAlerts - adds subscriber for alerts and sends it the firing alerts
+func (e *eventEmitter) AddSubscriberForAlerts(client *Client) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.subscribersOnAlerts = append(e.subscribersOnAlerts, client)
+
+	alerts := make([]*watcher.Alert, 0)
+	if alerting, ok := watcher.AsAlerting(e.watcher); ok {
+		alerts = alerting.ActiveAlerts()
+	}
+
+	client.SendJSON(events.AlertSubscribeEvent, AlertsPayload(alerts))
 }
 
 func (e *eventEmitter) RemoveSubscriberForRoot(client *Client) {
@@ -121,20 +360,74 @@ func (e *eventEmitter) RemoveSubscriberForRoot(client *Client) {
 	}
 }
 
-func (e *eventEmitter) RemoveSubscriberForFile(fileName string, client *Client) {
+func (e *eventEmitter) RemoveSubscriberForFile(sub *Subscription) {
 	e.Lock()
 	defer e.Unlock()
 
-	subscribers, ok := e.subscribersOnFile[fileName]
+	e.removeSubscriberForFile(sub)
+}
+
+func (e *eventEmitter) removeSubscriberForFile(sub *Subscription) {
+	subscribers, ok := e.subscribersOnFile[sub.File]
 	if !ok {
 		return
 	}
 
+	for i, subscriber := range subscribers {
+		if sub == subscriber {
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			break
+		}
+	}
+
+	if len(subscribers) == 0 {
+		delete(e.subscribersOnFile, sub.File)
+		return
+	}
+
+	e.subscribersOnFile[sub.File] = subscribers
+}
+
+// RemoveSubscriberForStats - removes stats subscription of the client
+func (e *eventEmitter) RemoveSubscriberForStats(client *Client) {
+	e.Lock()
+	defer e.Unlock()
+
+	e.removeSubscriberForStats(client, true)
+}
+
+// removeSubscriberForStats - removes client from subscribers of its stats file,
+// statistics is dropped with the last subscriber, if drop is set
+func (e *eventEmitter) removeSubscriberForStats(client *Client, drop bool) {
+	fileName := client.StatsFile
+	subscribers := e.subscribersOnStats[fileName]
+
 	for i, subscriber := range subscribers {
 		if client == subscriber {
 			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			break
 		}
 	}
 
-	e.subscribersOnFile[fileName] = subscribers
+	if len(subscribers) != 0 {
+		e.subscribersOnStats[fileName] = subscribers
+		return
+	}
+
+	delete(e.subscribersOnStats, fileName)
+	if drop {
+		delete(e.stats, fileName)
+	}
+}
+
+func (e *eventEmitter) RemoveSubscriberForAlerts(client *Client) {
+	e.Lock()
+	defer e.Unlock()
+
+	for i, subscriber := range e.subscribersOnAlerts {
+		if client == subscriber {
+			e.subscribersOnAlerts = append(e.subscribersOnAlerts[:i], e.subscribersOnAlerts[i+1:]...)
+			break
+		}
+	}
 }
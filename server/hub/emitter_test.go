@@ -0,0 +1,285 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lillilli/logger"
+
+	"github.com/lillilli/graphex/server/events"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// testWatcher - watcher of the files data, listing is blocked, while listingLock is held
+type testWatcher struct {
+	watcher.Watcher
+
+	events chan *watcher.Event
+	files  map[string]*watcher.FileData
+	err    error
+
+	listings    int
+	listingLock sync.Mutex
+	sync.Mutex
+}
+
+func newTestWatcher() *testWatcher {
+	return &testWatcher{events: make(chan *watcher.Event), files: make(map[string]*watcher.FileData)}
+}
+
+func (w *testWatcher) UpdatesChannel() <-chan *watcher.Event {
+	return w.events
+}
+
+func (w *testWatcher) State() []string {
+	return []string{"a.csv"}
+}
+
+func (w *testWatcher) FileState(name string) (*watcher.FileData, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.err != nil {
+		return nil, w.err
+	}
+
+	data, ok := w.files[name]
+	if !ok {
+		return nil, watcher.ErrNotWatched
+	}
+
+	return data, nil
+}
+
+func (w *testWatcher) Listing() []watcher.RootListing {
+	w.Lock()
+	w.listings++
+	w.Unlock()
+
+	w.listingLock.Lock()
+	defer w.listingLock.Unlock()
+
+	return []watcher.RootListing{}
+}
+
+func (w *testWatcher) setFile(name string, data *watcher.FileData, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.files[name] = data
+	w.err = err
+}
+
+func (w *testWatcher) listingsCount() int {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.listings
+}
+
+func newTestClient() *Client {
+	return NewClient(nil, nil, logger.NewLogger("test client"))
+}
+
+// next - returns the next message of the client, test fails, if there is no message during the timeout
+func next(t *testing.T, client *Client) *OutgoingMessage {
+	t.Helper()
+
+	select {
+	case msg := <-client.writeChannel:
+		return msg.(*OutgoingMessage)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message is not sent")
+		return nil
+	}
+}
+
+// none - checks, that there are no more messages of the client
+func none(t *testing.T, client *Client) {
+	t.Helper()
+
+	select {
+	case msg := <-client.writeChannel:
+		t.Fatalf("unexpected message %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// nextFile - returns the next file message of the client, checks its type, subscription id and data version
+func nextFile(t *testing.T, client *Client, msgType, id string, version uint64) *seriesFilePayload {
+	t.Helper()
+
+	msg := next(t, client)
+	if msg.Type != msgType {
+		t.Fatalf("expected %s message, got %s", msgType, msg.Type)
+	}
+
+	payload, ok := msg.Data.(*seriesFilePayload)
+	if !ok {
+		t.Fatalf("unexpected %s payload %+v", msgType, msg.Data)
+	}
+
+	if payload.ID != id || payload.DataVersion != version {
+		t.Fatalf("expected %s of %q with data version %d, got %q with %d", msgType, id, version, payload.ID, payload.DataVersion)
+	}
+
+	return payload
+}
+
+func testData(version uint64, x ...float64) *watcher.FileData {
+	values := make(watcher.SeriesValues, len(x))
+	copy(values, x)
+
+	return &watcher.FileData{X: x, Series: []*watcher.Series{{Name: "y", Values: values}}, Version: version}
+}
+
+func TestEmitterSubscriptions(t *testing.T) {
+	w := newTestWatcher()
+	w.setFile("a.csv", testData(1, 1, 2), nil)
+	w.setFile("b.csv", testData(2, 1), nil)
+
+	e := NewEventEmitter(w).(*eventEmitter)
+	client := newTestClient()
+
+	for _, sub := range []*Subscription{
+		{ID: "a", File: "a.csv", Version: SeriesVersion, Client: client},
+		{ID: "b", File: "b.csv", Version: SeriesVersion, Client: client},
+	} {
+		if err := e.AddSubscriberForFile(sub); err != nil {
+			t.Fatalf("subscribing failed: %v", err)
+		}
+
+		nextFile(t, client, events.FileSubscribeEvent, sub.ID, w.files[sub.File].Version)
+	}
+
+	if err := e.AddSubscriberForFile(&Subscription{ID: "c", File: "c.csv", Client: client}); err == nil {
+		t.Fatal("expected error of not watched file")
+	}
+
+	// subscription with the same id replaces the previous one
+	if err := e.AddSubscriberForFile(&Subscription{ID: "a", File: "b.csv", Version: SeriesVersion, Client: client}); err != nil {
+		t.Fatalf("subscribing failed: %v", err)
+	}
+
+	nextFile(t, client, events.FileSubscribeEvent, "a", 2)
+
+	if len(client.Subscriptions()) != 2 || len(e.subscribersOnFile["b.csv"]) != 2 {
+		t.Fatalf("expected 2 subscriptions, got %d", len(client.Subscriptions()))
+	}
+
+	if _, ok := e.subscribersOnFile["a.csv"]; ok {
+		t.Fatal("replaced subscription is not removed")
+	}
+
+	e.sendEventForFile(events.FileAppendEvent, &watcher.Event{Type: watcher.AppendState, Name: "a.csv", Values: testData(3, 3)})
+	none(t, client)
+
+	// both subscriptions receive the event, already sent version is skipped
+	e.sendEventForFile(events.FileAppendEvent, &watcher.Event{Type: watcher.AppendState, Name: "b.csv", Values: testData(2, 2)})
+	none(t, client)
+
+	e.sendEventForFile(events.FileAppendEvent, &watcher.Event{Type: watcher.AppendState, Name: "b.csv", Values: testData(4, 2)})
+	ids := map[string]bool{}
+
+	for i := 0; i < 2; i++ {
+		msg := next(t, client)
+		ids[msg.Data.(*seriesFilePayload).ID] = true
+	}
+
+	if !ids["a"] || !ids["b"] {
+		t.Fatalf("expected appends of both subscriptions, got %v", ids)
+	}
+
+	sub, ok := client.Unsubscribe("b")
+	if !ok {
+		t.Fatal("subscription is not found")
+	}
+
+	e.RemoveSubscriberForFile(sub)
+
+	e.sendEventForFile(events.FileAppendEvent, &watcher.Event{Type: watcher.AppendState, Name: "b.csv", Values: testData(5, 3)})
+	nextFile(t, client, events.FileAppendEvent, "a", 5)
+	none(t, client)
+}
+
+func TestEmitterLegacyAppends(t *testing.T) {
+	w := newTestWatcher()
+	w.setFile("a.csv", testData(1, 1), nil)
+
+	e := NewEventEmitter(w).(*eventEmitter)
+	legacy, client := newTestClient(), newTestClient()
+
+	for _, sub := range []*Subscription{{File: "a.csv", Version: LegacyVersion, Client: legacy}, {File: "a.csv", Version: SeriesVersion, Client: client}} {
+		if err := e.AddSubscriberForFile(sub); err != nil {
+			t.Fatalf("subscribing failed: %v", err)
+		}
+
+		next(t, sub.Client)
+	}
+
+	// legacy subscriber misses the append, if the file could not be read, but receives the whole file later
+	w.setFile("a.csv", testData(2, 1, 2), errors.New("reading failed"))
+	e.sendEventForFile(events.FileAppendEvent, &watcher.Event{Type: watcher.AppendState, Name: "a.csv", Values: testData(2, 2)})
+
+	nextFile(t, client, events.FileAppendEvent, "", 2)
+	none(t, legacy)
+
+	w.setFile("a.csv", testData(3, 1, 2, 3), nil)
+	e.sendEventForFile(events.FileAppendEvent, &watcher.Event{Type: watcher.AppendState, Name: "a.csv", Values: testData(3, 3)})
+
+	nextFile(t, client, events.FileAppendEvent, "", 3)
+
+	msg := next(t, legacy)
+	if payload, ok := msg.Data.(*legacyFilePayload); msg.Type != events.FileSubscribeEvent || !ok || len(payload.Values) != 3 {
+		t.Fatalf("expected whole file, got %s %+v", msg.Type, msg.Data)
+	}
+}
+
+func TestEmitterRootUpdates(t *testing.T) {
+	w := newTestWatcher()
+	w.setFile("a.csv", testData(1, 1), nil)
+
+	e := NewEventEmitter(w).(*eventEmitter)
+	client := newTestClient()
+
+	e.AddSubscriberForRoot(client)
+	e.SetRootVersion(client, ListingVersion)
+	next(t, client)
+	next(t, client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e.Start(ctx)
+
+	// file events are handled, while files listing is built, changes during the building are sent once
+	w.listingLock.Lock()
+	w.events <- &watcher.Event{Type: watcher.ModifyState, Name: "a.csv", Values: testData(2, 1)}
+
+	for w.listingsCount() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		w.events <- &watcher.Event{Type: watcher.ModifyState, Name: "a.csv", Values: testData(uint64(i+3), 1)}
+	}
+
+	// alert event is received, when the previous events are handled
+	w.events <- &watcher.Event{Type: watcher.AlertState, Alert: &watcher.Alert{}}
+	w.listingLock.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if msg := next(t, client); msg.Type != events.RootSubscribeEvent {
+			t.Fatalf("expected %s message, got %s", events.RootSubscribeEvent, msg.Type)
+		}
+	}
+
+	none(t, client)
+
+	if count := w.listingsCount(); count != 3 {
+		t.Fatalf("expected 3 listings, got %d", count)
+	}
+}
@@ -84,7 +84,13 @@ func (h *Hub) run() {
 				h.log.Infof("Client disconnect: %#v (clients: %d)", client.conn.RemoteAddr().String(), len(h.clients))
 
 				h.emitter.RemoveSubscriberForRoot(client)
-				h.emitter.RemoveSubscriberForFile(client.CurrentFile, client)
+				h.emitter.RemoveSubscriberForStats(client)
+				h.emitter.RemoveSubscriberForAlerts(client)
+
+				for _, sub := range client.Subscriptions() {
+					h.emitter.RemoveSubscriberForFile(sub)
+				}
+
 				client.Close()
 			}
 
@@ -0,0 +1,153 @@
+package hub
+
+import (
+	"github.com/lillilli/graphex/watcher"
+)
+
+const (
+	// LegacyVersion - file messages version with [x, y] pairs of the first series only
+	LegacyVersion = 1
+
+	// SeriesVersion - file messages version with x vector and all of y series
+	SeriesVersion = 2
+)
+
+const (
+	// LegacyRootVersion - root messages version with flat list of file names
+	LegacyRootVersion = 1
+
+	// RootsVersion - root messages version with files, grouped by watch roots
+	RootsVersion = 2
+
+	// ListingVersion - root messages version with files metadata, grouped by watch roots
+	ListingVersion = 3
+)
+
+// legacyFilePayload - file data in the legacy message format
+type legacyFilePayload struct {
+	ID          string       `json:"id,omitempty"`
+	Columns     []string     `json:"columns,omitempty"`
+	XAxis       string       `json:"x_axis,omitempty"`
+	WindowStart *float64     `json:"window_start,omitempty"`
+	Values      [][2]float64 `json:"values"`
+}
+
+// seriesFilePayload - file data in the series message format
+type seriesFilePayload struct {
+	ID          string   `json:"id,omitempty"`
+	Version     int      `json:"version"`
+	DataVersion uint64   `json:"data_version"`
+	WindowStart *float64 `json:"window_start,omitempty"`
+	*watcher.FileData
+}
+
+// SupportedVersion - checks, if file messages version is supported
+func SupportedVersion(version int) bool {
+	return version == LegacyVersion || version == SeriesVersion
+}
+
+// FilePayload - returns file data in the message format of requested version
+func FilePayload(data *watcher.FileData, version int) interface{} {
+	return filePayload(data, version, nil, "")
+}
+
+// filePayload - returns file data of the subscription with id, window start x is sent for windowed subscriptions,
+// so clients could drop points with less x
+func filePayload(data *watcher.FileData, version int, windowStart *float64, id string) interface{} {
+	if version == SeriesVersion {
+		return &seriesFilePayload{ID: id, Version: SeriesVersion, DataVersion: data.Version, WindowStart: windowStart, FileData: data}
+	}
+
+	return &legacyFilePayload{ID: id, Columns: data.Columns, XAxis: data.XAxis, WindowStart: windowStart, Values: data.Points()}
+}
+
+// rangePayload - file points in x range with their level of detail
+type rangePayload struct {
+	Name       string      `json:"name"`
+	From       float64     `json:"from"`
+	To         float64     `json:"to"`
+	Level      int         `json:"level"`
+	BucketSize int         `json:"bucket_size"`
+	Data       interface{} `json:"data"`
+}
+
+// RangePayload - returns range query result, points are in the file message format of requested version
+func RangePayload(name string, data *watcher.RangeData, version int) interface{} {
+	return &rangePayload{
+		Name:       name,
+		From:       data.From,
+		To:         data.To,
+		Level:      data.Level,
+		BucketSize: data.BucketSize,
+		Data:       FilePayload(data.FileData, version),
+	}
+}
+
+// statsPayload - file series statistics
+type statsPayload struct {
+	Name        string                 `json:"name"`
+	DataVersion uint64                 `json:"data_version"`
+	Series      []*watcher.SeriesStats `json:"series"`
+}
+
+// StatsPayload - returns file series statistics
+func StatsPayload(name string, stats *watcher.StatsData) interface{} {
+	return &statsPayload{Name: name, DataVersion: stats.Version, Series: stats.Series}
+}
+
+// alertsPayload - firing alerts
+type alertsPayload struct {
+	Alerts []*watcher.Alert `json:"alerts"`
+}
+
+// AlertsPayload - returns firing alerts, sent on alert subscription
+func AlertsPayload(alerts []*watcher.Alert) interface{} {
+	return &alertsPayload{Alerts: alerts}
+}
+
+// virtualPayload - full name of the defined or removed virtual file
+type virtualPayload struct {
+	Name string `json:"name"`
+}
+
+// VirtualPayload - returns virtual file name, which clients use to subscribe to the file
+func VirtualPayload(name string) interface{} {
+	return &virtualPayload{Name: watcher.VirtualRootName + watcher.RootSeparator + name}
+}
+
+// warningsPayload - file parse warnings
+type warningsPayload struct {
+	ID       string                `json:"id,omitempty"`
+	Name     string                `json:"name"`
+	Total    int                   `json:"total"`
+	Warnings []*watcher.Diagnostic `json:"warnings"`
+}
+
+// rootsPayload - watch roots with their files
+type rootsPayload struct {
+	Version int                 `json:"version"`
+	Roots   []watcher.RootState `json:"roots"`
+}
+
+// listingPayload - watch roots with their files metadata
+type listingPayload struct {
+	Version int                   `json:"version"`
+	Roots   []watcher.RootListing `json:"roots"`
+}
+
+// SupportedRootVersion - checks, if root messages version is supported
+func SupportedRootVersion(version int) bool {
+	return version >= LegacyRootVersion && version <= ListingVersion
+}
+
+// RootPayload - returns watcher state in the root message format of requested version
+func RootPayload(w watcher.Watcher, version int) interface{} {
+	switch version {
+	case RootsVersion:
+		return &rootsPayload{Version: RootsVersion, Roots: w.Roots()}
+	case ListingVersion:
+		return &listingPayload{Version: ListingVersion, Roots: w.Listing()}
+	}
+
+	return w.State()
+}
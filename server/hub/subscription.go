@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"math"
+
+	"github.com/lillilli/graphex/watcher"
+)
+
+// Subscription - client subscription for file updates with its own messages format, window and downsampling,
+// messages of the subscription are tagged with its id (legacy clients use the default subscription with empty id)
+type Subscription struct {
+	ID      string
+	File    string
+	Version int
+
+	// Window - keeps only the last points of the subscription, whole file is sent, if it is nil
+	Window *watcher.Window
+	// Downsampler - reduces file data of the subscription, data is sent as is, if it is nil
+	Downsampler *watcher.Downsampler
+
+	Client *Client
+
+	// dataVersion - version of the last sent file data, events with not greater versions are already sent
+	dataVersion uint64
+}
+
+// Appends - checks, if the subscription receives appended points as file_append messages,
+// legacy clients handle only file_subscribe messages, so they receive the whole file on appends
+func (s *Subscription) Appends() bool {
+	return s.Version != LegacyVersion
+}
+
+// Payload - applies subscription window and downsampling to the file data (appended points or the whole file)
+// and returns it in the client messages format, returns false, if there are no points to send yet
+func (s *Subscription) Payload(data *watcher.FileData, appended bool) (interface{}, bool) {
+	values, start := data, math.NaN()
+
+	if s.Window != nil {
+		if appended {
+			values, start = s.Window.ApplyTail(values)
+		} else {
+			values, start = s.Window.Apply(values)
+		}
+	}
+
+	if s.Downsampler != nil {
+		if appended {
+			values = s.Downsampler.ReduceTail(values)
+		} else {
+			values = s.Downsampler.Reduce(values)
+		}
+	}
+
+	// appended points could be delayed by downsampling until there are enough of them
+	if appended && values.Len() == 0 && data.Len() != 0 {
+		return nil, false
+	}
+
+	var windowStart *float64
+	if s.Window != nil && !math.IsNaN(start) {
+		windowStart = &start
+	}
+
+	return filePayload(values, s.Version, windowStart, s.ID), true
+}
+
+// WarningsPayload - returns parse warnings of the file data message, tagged with the subscription id
+func (s *Subscription) WarningsPayload(data *watcher.FileData) interface{} {
+	return &warningsPayload{ID: s.ID, Name: s.File, Total: data.WarningsCount, Warnings: data.Warnings}
+}
+
+// subscriptionPayload - id of the removed subscription
+type subscriptionPayload struct {
+	ID string `json:"id"`
+}
+
+// UnsubscribePayload - returns id of the removed subscription, sent on file unsubscribe
+func UnsubscribePayload(id string) interface{} {
+	return &subscriptionPayload{ID: id}
+}
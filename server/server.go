@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -26,6 +27,7 @@ type server struct {
 	hub     *hub.Hub
 	cfg     *config.Config
 	manager handler.Manager
+	watcher watcher.Watcher
 
 	log logger.Logger
 
@@ -46,6 +48,7 @@ func NewServer(cfg *config.Config, watcher watcher.Watcher) Server {
 
 		hub:     hub.New(ctx, eventEmitter),
 		manager: handler.NewManager(eventEmitter, watcher),
+		watcher: watcher,
 
 		cancel: cancel,
 		log:    logger.NewLogger("ws server"),
@@ -60,6 +63,7 @@ func (s *server) Start() error {
 	s.hub.Start()
 	http.Handle("/", http.FileServer(http.Dir(s.cfg.FrontendDistPath)))
 	http.HandleFunc("/ws", s.handleWS)
+	http.HandleFunc("/health", s.handleHealth)
 
 	go func() {
 		s.log.Errorf("Serving error: %v", http.ListenAndServe(addr, nil))
@@ -80,6 +84,20 @@ func (s server) handleWS(w http.ResponseWriter, r *http.Request) {
 	go s.manager.HandleClientEvents(client)
 }
 
+// handleHealth - returns watcher health state, status code is 503, if watcher is degraded
+func (s server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	health := s.watcher.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+	if health.Status != watcher.HealthOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		s.log.Warnf("Sending health state failed: %v", err)
+	}
+}
+
 // Stop - stop server work
 func (s server) Stop() {
 	s.cancel()
@@ -0,0 +1,228 @@
+package watcher
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+const (
+	// ThresholdRule - fires, when value is above or below limits
+	ThresholdRule = "threshold"
+
+	// RateRule - fires, when change of value per x unit (per second for time x axis) is above or below limits
+	RateRule = "rate"
+
+	// AbsenceRule - fires, when file is not updated for the duration
+	AbsenceRule = "absence"
+
+	// BandRule - fires, when value is out of mean ± K standard deviations of the previous values
+	BandRule = "band"
+)
+
+const (
+	// AlertFiring - alert state, when rule condition is met
+	AlertFiring = "firing"
+
+	// AlertResolved - alert state, when rule condition is not met anymore
+	AlertResolved = "resolved"
+)
+
+// defaultBandK - standard deviations count of band rule, if it is not set
+const defaultBandK = 3
+
+// Alert - fired or resolved alert of the rule on the file series (series is empty for absence rules)
+type Alert struct {
+	Rule    string    `json:"rule"`
+	Type    string    `json:"type"`
+	File    string    `json:"file"`
+	Series  string    `json:"series,omitempty"`
+	State   string    `json:"state"`
+	X       *float64  `json:"x,omitempty"`
+	Value   *float64  `json:"value,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// alertRule - validated alert rule
+type alertRule struct {
+	config.AlertRule
+}
+
+func newAlertRule(cfg config.AlertRule) (*alertRule, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("no rule name")
+	}
+
+	if _, err := path.Match(cfg.File, ""); err != nil || cfg.File == "" {
+		return nil, errors.Errorf("bad file pattern %q", cfg.File)
+	}
+
+	switch cfg.Type {
+	case ThresholdRule, RateRule:
+		if cfg.Above == nil && cfg.Below == nil {
+			return nil, errors.New("no limits")
+		}
+
+	case AbsenceRule:
+		if cfg.For <= 0 {
+			return nil, errors.New("no absence duration")
+		}
+
+	case BandRule:
+		if cfg.Window < 2 {
+			return nil, errors.Errorf("bad band window %d", cfg.Window)
+		}
+
+		if cfg.K == 0 {
+			cfg.K = defaultBandK
+		}
+
+		if cfg.K < 0 || math.IsNaN(cfg.K) {
+			return nil, errors.Errorf("bad band width %v", cfg.K)
+		}
+
+	default:
+		return nil, errors.Errorf("unknown rule type %q", cfg.Type)
+	}
+
+	return &alertRule{AlertRule: cfg}, nil
+}
+
+// matches - checks, if the rule checks the file
+func (r *alertRule) matches(file string) bool {
+	ok, _ := path.Match(r.File, file)
+	return ok
+}
+
+// checksSeries - checks, if the rule checks the series
+func (r *alertRule) checksSeries(series string) bool {
+	return r.Type != AbsenceRule && (r.Series == "" || r.Series == series)
+}
+
+// exceeds - returns description of the exceeded limit, returns false, if value is within limits
+func (r *alertRule) exceeds(v float64) (string, bool) {
+	if r.Above != nil && v > *r.Above {
+		return fmt.Sprintf("above %g", *r.Above), true
+	}
+
+	if r.Below != nil && v < *r.Below {
+		return fmt.Sprintf("below %g", *r.Below), true
+	}
+
+	return "", false
+}
+
+// alertState - state of the rule on the file series: whether alert is firing,
+// the previous point for rate rules and the previous values window for band rules
+type alertState struct {
+	firing bool
+
+	// points - count of checked points of the file, lastX - x of the last checked point
+	points int
+	lastX  float64
+
+	hasLast      bool
+	prevX, prevY float64
+
+	window  []float64
+	next    int
+	moments moments
+}
+
+// observe - checks the next point of the series by the previous points and adds it to them,
+// returns false, if there are not enough previous points
+func (s *alertState) observe(r *alertRule, series, xAxis string, x, y float64) (bool, string, bool) {
+	switch r.Type {
+	case ThresholdRule:
+		limit, firing := r.exceeds(y)
+		return firing, fmt.Sprintf("%s = %g is %s", series, y, limit), true
+
+	case RateRule:
+		defer func() { s.hasLast, s.prevX, s.prevY = true, x, y }()
+
+		if !s.hasLast || x == s.prevX {
+			return false, "", false
+		}
+
+		rate := (y - s.prevY) / (x - s.prevX)
+		if xAxis == TimeAxis {
+			rate *= float64(time.Second / time.Millisecond)
+		}
+
+		limit, firing := r.exceeds(rate)
+		return firing, fmt.Sprintf("rate of %s = %g is %s", series, rate, limit), true
+
+	case BandRule:
+		// infinite value is out of any band, it is not added to the window, so the next values are checked by finite ones
+		if finite(y) {
+			defer s.push(r.Window, y)
+		}
+
+		if len(s.window) < r.Window {
+			return false, "", false
+		}
+
+		mean, std := s.moments.mean, s.moments.std()
+
+		return math.Abs(y-mean) > r.K*std, fmt.Sprintf("%s = %g is out of %g ± %g", series, y, mean, r.K*std), true
+	}
+
+	return false, "", false
+}
+
+// check - checks the next point of the series, returns alert, if alert state is changed
+func (s *alertState) check(r *alertRule, file, series, xAxis string, x, y float64) *Alert {
+	s.points++
+	s.lastX = x
+
+	if math.IsNaN(y) {
+		return nil
+	}
+
+	firing, message, ok := s.observe(r, series, xAxis, x, y)
+	if !ok || firing == s.firing {
+		return nil
+	}
+
+	s.firing = firing
+	alert := &Alert{Rule: r.Name, Type: r.Type, File: file, Series: series, State: AlertFiring, X: floatPtr(x), Value: floatPtr(y), Message: message, Time: time.Now()}
+
+	if !firing {
+		alert.State = AlertResolved
+		alert.Message = fmt.Sprintf("%s = %g", series, y)
+	}
+
+	return alert
+}
+
+// continues - checks, if the file data starts with the checked points
+func (s *alertState) continues(data *FileData) bool {
+	return s.points > 0 && s.points <= data.Len() && data.X[s.points-1] == s.lastX
+}
+
+// reset - drops the previous points, alert state is kept
+func (s *alertState) reset() {
+	s.points = 0
+	s.hasLast = false
+	s.window, s.next, s.moments = nil, 0, moments{}
+}
+
+// push - adds value to the window of the previous values, the oldest value is dropped from the full window,
+// mean and variance of the window are updated by Welford's algorithm, so they are not lost for large values
+func (s *alertState) push(size int, v float64) {
+	if len(s.window) < size {
+		s.window = append(s.window, v)
+	} else {
+		s.moments.remove(s.window[s.next])
+		s.window[s.next] = v
+		s.next = (s.next + 1) % size
+	}
+
+	s.moments.add(v)
+}
@@ -0,0 +1,476 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lillilli/logger"
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// AlertState - event type of fired or resolved alert, event name is the alert file name
+const AlertState = "ALERT"
+
+// ErrUnknownAlertRule - returns, when rule name points to not defined alert rule
+var ErrUnknownAlertRule = errors.New("unknown alert rule")
+
+// Alerting - watcher, which evaluates alert rules on file events and allows to define and remove rules at runtime
+type Alerting interface {
+	DefineAlert(rule config.AlertRule) error
+	RemoveAlert(name string) error
+	ActiveAlerts() []*Alert
+}
+
+// alertWatcher - adds alert events to the events of the watcher,
+// appended points are checked one by one and only the last point is checked for rewritten files
+type alertWatcher struct {
+	Watcher
+
+	rules   map[string]*alertRule
+	states  map[string]*alertState
+	active  map[string]*Alert
+	updated map[string]time.Time
+
+	logFile       string
+	checkInterval time.Duration
+	started       bool
+
+	events chan *Event
+	log    logger.Logger
+	sync.Mutex
+}
+
+// NewAlerting - returns watcher, which evaluates alert rules, defined in config, on events of w
+func NewAlerting(w Watcher, cfg config.Alerts) (Watcher, error) {
+	a := &alertWatcher{
+		Watcher: w,
+		rules:   make(map[string]*alertRule),
+		states:  make(map[string]*alertState),
+		active:  make(map[string]*Alert),
+		updated: make(map[string]time.Time),
+
+		logFile:       cfg.LogFile,
+		checkInterval: cfg.CheckInterval,
+
+		events: make(chan *Event),
+		log:    logger.NewLogger("alerting"),
+	}
+
+	if a.checkInterval <= 0 {
+		a.checkInterval = time.Second
+	}
+
+	for _, rule := range cfg.Rules {
+		if err := a.DefineAlert(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// DefineAlert - adds alert rule, the last points of matched files are checked at once
+func (a *alertWatcher) DefineAlert(cfg config.AlertRule) error {
+	rule, err := newAlertRule(cfg)
+	if err != nil {
+		return errors.Wrapf(err, "creating alert rule %q failed", cfg.Name)
+	}
+
+	a.Lock()
+
+	if _, ok := a.rules[rule.Name]; ok {
+		a.Unlock()
+		return errors.Errorf("duplicated alert rule name %q", rule.Name)
+	}
+
+	a.rules[rule.Name] = rule
+	started := a.started
+	a.Unlock()
+
+	if started {
+		a.checkFiles(rule)
+	}
+
+	return nil
+}
+
+// RemoveAlert - removes alert rule, its firing alerts are resolved
+func (a *alertWatcher) RemoveAlert(name string) error {
+	a.Lock()
+
+	if _, ok := a.rules[name]; !ok {
+		a.Unlock()
+		return ErrUnknownAlertRule
+	}
+
+	delete(a.rules, name)
+	alerts := a.resolveAll(func(alert *Alert) bool { return alert.Rule == name }, "rule removed")
+
+	for key := range a.states {
+		if ruleName(key) == name {
+			delete(a.states, key)
+		}
+	}
+
+	a.Unlock()
+
+	a.send(alerts)
+	return nil
+}
+
+// ActiveAlerts - returns firing alerts, sorted by rule, file and series
+func (a *alertWatcher) ActiveAlerts() []*Alert {
+	a.Lock()
+	defer a.Unlock()
+
+	alerts := make([]*Alert, 0, len(a.active))
+	for _, alert := range a.active {
+		alerts = append(alerts, alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		return alertKey(alerts[i].Rule, alerts[i].File, alerts[i].Series) < alertKey(alerts[j].Rule, alerts[j].File, alerts[j].Series)
+	})
+
+	return alerts
+}
+
+func (a *alertWatcher) Start(ctx context.Context) error {
+	if err := a.Watcher.Start(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	a.Lock()
+	for _, name := range a.Watcher.State() {
+		a.updated[name] = now
+	}
+
+	a.started = true
+	a.Unlock()
+
+	go a.forwardEvents(ctx)
+	go a.checkAbsence(ctx)
+	return nil
+}
+
+func (a *alertWatcher) UpdatesChannel() <-chan *Event {
+	return a.events
+}
+
+// Unwrap - returns watcher, which events are checked
+func (a *alertWatcher) Unwrap() Watcher {
+	return a.Watcher
+}
+
+// forwardEvents - sends watcher events and alerts, which are changed by them
+func (a *alertWatcher) forwardEvents(ctx context.Context) {
+	a.checkFiles(nil)
+	updates := a.Watcher.UpdatesChannel()
+
+	for {
+		select {
+		case event := <-updates:
+			a.events <- event
+			a.send(a.evaluate(event))
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkFiles - checks the last points of existing files, matched by the rule (or by any rule, if it is nil)
+func (a *alertWatcher) checkFiles(rule *alertRule) {
+	for _, name := range a.Watcher.State() {
+		if !a.checked(rule, name) {
+			continue
+		}
+
+		data, err := a.Watcher.FileState(name)
+		if err != nil {
+			a.log.Warnf("Reading file %q for alert rules failed: %v", name, err)
+			continue
+		}
+
+		a.send(a.evaluate(&Event{Type: ModifyState, Name: name, Values: data}))
+	}
+}
+
+// checked - checks, if the file is matched by the rule or by any rule, if it is nil
+func (a *alertWatcher) checked(rule *alertRule, file string) bool {
+	if rule != nil {
+		return rule.Type != AbsenceRule && rule.matches(file)
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	for _, rule := range a.rules {
+		if rule.Type != AbsenceRule && rule.matches(file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkAbsence - periodically checks, if files are not updated for the duration of absence rules
+func (a *alertWatcher) checkAbsence(ctx context.Context) {
+	ticker := time.NewTicker(a.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			a.send(a.evaluateAbsence(now))
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *alertWatcher) evaluateAbsence(now time.Time) []*Alert {
+	a.Lock()
+	defer a.Unlock()
+
+	alerts := make([]*Alert, 0)
+
+	for _, rule := range a.sortedRules() {
+		if rule.Type != AbsenceRule {
+			continue
+		}
+
+		for file, updated := range a.updated {
+			if !rule.matches(file) || now.Sub(updated) <= rule.For {
+				continue
+			}
+
+			state := a.state(rule.Name, file, "")
+			if state.firing {
+				continue
+			}
+
+			state.firing = true
+			message := fmt.Sprintf("no updates for %s", rule.For)
+			alerts = append(alerts, a.activate(&Alert{Rule: rule.Name, Type: rule.Type, File: file, State: AlertFiring, Message: message, Time: now}))
+		}
+	}
+
+	return alerts
+}
+
+// evaluate - checks rules of the event file, returns changed alerts
+func (a *alertWatcher) evaluate(event *Event) []*Alert {
+	a.Lock()
+	defer a.Unlock()
+
+	if event.Type == RemoveState {
+		delete(a.updated, event.Name)
+		alerts := a.resolveAll(func(alert *Alert) bool { return alert.File == event.Name }, "file removed")
+
+		for key := range a.states {
+			if fileName(key) == event.Name {
+				delete(a.states, key)
+			}
+		}
+
+		return alerts
+	}
+
+	a.updated[event.Name] = time.Now()
+	alerts := make([]*Alert, 0)
+
+	for _, rule := range a.sortedRules() {
+		if !rule.matches(event.Name) {
+			continue
+		}
+
+		if rule.Type == AbsenceRule {
+			if state := a.state(rule.Name, event.Name, ""); state.firing {
+				state.firing = false
+				alerts = append(alerts, a.deactivate(rule.Name, event.Name, "", "file updated"))
+			}
+
+			continue
+		}
+
+		if event.Values == nil {
+			continue
+		}
+
+		for _, series := range event.Values.Series {
+			if rule.checksSeries(series.Name) {
+				alerts = append(alerts, a.check(rule, event, series)...)
+			}
+		}
+	}
+
+	return alerts
+}
+
+// check - checks new points of the series of the event, points of the rewritten file are new,
+// if the file starts with the previously checked points, otherwise only the last point is checked
+// and the previous ones are used as history of rate and band rules
+func (a *alertWatcher) check(rule *alertRule, event *Event, series *Series) []*Alert {
+	data := event.Values
+	state := a.state(rule.Name, event.Name, series.Name)
+	start := 0
+
+	switch {
+	case event.Type == AppendState:
+		// appended points follow the checked ones, so the count of checked points is kept
+	case state.continues(data):
+		start = state.points
+	default:
+		state.reset()
+
+		last := data.Len() - 1
+		for i := last - rule.Window - 1; i < last; i++ {
+			if i >= 0 && !math.IsNaN(series.Values[i]) {
+				state.observe(rule, series.Name, data.XAxis, data.X[i], series.Values[i])
+			}
+		}
+
+		if last < 0 {
+			return nil
+		}
+
+		start = last
+		state.points = last
+	}
+
+	alerts := make([]*Alert, 0)
+
+	for i := start; i < data.Len(); i++ {
+		alert := state.check(rule, event.Name, series.Name, data.XAxis, data.X[i], series.Values[i])
+		if alert == nil {
+			continue
+		}
+
+		if alert.State == AlertFiring {
+			alerts = append(alerts, a.activate(alert))
+		} else {
+			delete(a.active, alertKey(alert.Rule, alert.File, alert.Series))
+			alerts = append(alerts, alert)
+		}
+	}
+
+	return alerts
+}
+
+// sortedRules - returns rules, sorted by name, so alerts of the same event are sent in stable order
+func (a *alertWatcher) sortedRules() []*alertRule {
+	rules := make([]*alertRule, 0, len(a.rules))
+	for _, rule := range a.rules {
+		rules = append(rules, rule)
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// state - returns state of the rule on the file series, state is created, if there is no such state
+func (a *alertWatcher) state(rule, file, series string) *alertState {
+	key := alertKey(rule, file, series)
+
+	state, ok := a.states[key]
+	if !ok {
+		state = &alertState{}
+		a.states[key] = state
+	}
+
+	return state
+}
+
+func (a *alertWatcher) activate(alert *Alert) *Alert {
+	a.active[alertKey(alert.Rule, alert.File, alert.Series)] = alert
+	return alert
+}
+
+// deactivate - returns resolved alert of the firing one
+func (a *alertWatcher) deactivate(rule, file, series, message string) *Alert {
+	key := alertKey(rule, file, series)
+
+	alert := &Alert{Rule: rule, File: file, Series: series, State: AlertResolved, Message: message, Time: time.Now()}
+	if active, ok := a.active[key]; ok {
+		alert.Type = active.Type
+	}
+
+	delete(a.active, key)
+	return alert
+}
+
+// resolveAll - resolves firing alerts, matched by filter
+func (a *alertWatcher) resolveAll(filter func(alert *Alert) bool, message string) []*Alert {
+	alerts := make([]*Alert, 0)
+
+	for _, active := range a.active {
+		if filter(active) {
+			alerts = append(alerts, a.deactivate(active.Rule, active.File, active.Series, message))
+		}
+	}
+
+	return alerts
+}
+
+// send - sends alert events and appends alerts to the alert log
+func (a *alertWatcher) send(alerts []*Alert) {
+	for _, alert := range alerts {
+		a.log.Infof("Alert %q is %s for %q: %s", alert.Rule, alert.State, alert.File, alert.Message)
+
+		if err := a.appendLog(alert); err != nil {
+			a.log.Errorf("Writing alert log failed: %v", err)
+		}
+
+		a.events <- &Event{Type: AlertState, Name: alert.File, Alert: alert}
+	}
+}
+
+// appendLog - appends alert to the alert log file as JSON line
+func (a *alertWatcher) appendLog(alert *Alert) error {
+	if a.logFile == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(a.logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// alertKey - returns key of the rule state on the file series, parts are separated by zero byte
+func alertKey(rule, file, series string) string {
+	return rule + "\x00" + file + "\x00" + series
+}
+
+func ruleName(key string) string {
+	return strings.SplitN(key, "\x00", 3)[0]
+}
+
+func fileName(key string) string {
+	return strings.SplitN(key, "\x00", 3)[1]
+}
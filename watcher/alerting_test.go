@@ -0,0 +1,67 @@
+package watcher
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// newTestAlerting - returns alerting of the rule, events are evaluated without the watcher
+func newTestAlerting(t *testing.T, rule config.AlertRule) *alertWatcher {
+	t.Helper()
+
+	a, err := NewAlerting(nil, config.Alerts{Rules: []config.AlertRule{rule}})
+	if err != nil {
+		t.Fatalf("creating alerting failed: %v", err)
+	}
+
+	return a.(*alertWatcher)
+}
+
+// checkAlerts - evaluates the event of the file points, checks states and x of the changed alerts
+func checkAlerts(t *testing.T, a *alertWatcher, eventType string, x []float64, values SeriesValues, expected ...string) {
+	t.Helper()
+
+	event := &Event{Type: eventType, Name: "a.csv", Values: newTestData([]string{"x", "y"}, x, values)}
+	alerts := make([]string, 0)
+
+	for _, alert := range a.evaluate(event) {
+		alerts = append(alerts, fmt.Sprintf("%s at %g", alert.State, *alert.X))
+	}
+
+	if fmt.Sprint(alerts) != fmt.Sprint(expected) {
+		t.Fatalf("%s of %v: expected alerts %q, got %q", eventType, x, expected, alerts)
+	}
+}
+
+func TestAlertingRewrittenFile(t *testing.T) {
+	a := newTestAlerting(t, config.AlertRule{Name: "high", File: "*.csv", Type: ThresholdRule, Above: floatPtr(10)})
+
+	checkAlerts(t, a, ModifyState, []float64{1, 2, 3}, SeriesValues{1, 2, 3})
+	checkAlerts(t, a, AppendState, []float64{4, 5}, SeriesValues{4, 5})
+
+	// rewritten file starts with the created and appended points, so all new points are checked
+	checkAlerts(t, a, ModifyState, []float64{1, 2, 3, 4, 5, 6, 7}, SeriesValues{1, 2, 3, 4, 5, 20, 6}, "firing at 6", "resolved at 7")
+	checkAlerts(t, a, AppendState, []float64{8}, SeriesValues{30}, "firing at 8")
+
+	// only the last point of the changed file is checked
+	checkAlerts(t, a, ModifyState, []float64{1, 2, 3}, SeriesValues{1, 2, 3}, "resolved at 3")
+	checkAlerts(t, a, ModifyState, []float64{1, 2, 3, 4}, SeriesValues{1, 2, 3, 40}, "firing at 4")
+}
+
+func TestAlertingBand(t *testing.T) {
+	a := newTestAlerting(t, config.AlertRule{Name: "band", File: "*.csv", Type: BandRule, Window: 3, K: 3})
+
+	values := SeriesValues{1, 2, 1, 2, 1.5, 10, 1.5, math.Inf(1), 1.5}
+	for i := range values {
+		values[i] += 1e9
+	}
+
+	checkAlerts(t, a, ModifyState, []float64{1}, values[:1])
+	checkAlerts(t, a, AppendState, []float64{2, 3, 4, 5}, values[1:5])
+
+	// variance of large values is not lost, infinite value does not change the window
+	checkAlerts(t, a, AppendState, []float64{6, 7, 8, 9}, values[5:], "firing at 6", "resolved at 7", "firing at 8", "resolved at 9")
+}
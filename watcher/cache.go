@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cache - LRU cache of parsed files, limited by the approximate memory budget
+type cache struct {
+	budget int64
+	used   int64
+
+	entries map[string]*list.Element
+	lru     *list.List
+	sync.Mutex
+}
+
+type cacheEntry struct {
+	name string
+	data *FileData
+	size int64
+
+	// mergeable - data is consistent with the tail state and appended lines could be merged into it
+	mergeable bool
+}
+
+// newCache - returns new cache, budget is in bytes, zero budget disables caching
+func newCache(budget int64) *cache {
+	return &cache{
+		budget:  budget,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *cache) get(name string) (*FileData, bool) {
+	entry, ok := c.entry(name)
+	if !ok {
+		return nil, false
+	}
+
+	return entry.data, true
+}
+
+func (c *cache) entry(name string) (*cacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	element, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	return element.Value.(*cacheEntry), true
+}
+
+// put - caches file data, least recently used entries are evicted to fit the budget
+func (c *cache) put(name string, data *FileData, mergeable bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.removeEntry(name)
+
+	size := data.Size()
+	if size > c.budget {
+		return
+	}
+
+	c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, data: data, size: size, mergeable: mergeable})
+	c.used += size
+
+	for c.used > c.budget {
+		c.removeEntry(c.lru.Back().Value.(*cacheEntry).name)
+	}
+}
+
+func (c *cache) remove(name string) {
+	c.Lock()
+	c.removeEntry(name)
+	c.Unlock()
+}
+
+func (c *cache) removeEntry(name string) {
+	element, ok := c.entries[name]
+	if !ok {
+		return
+	}
+
+	c.used -= element.Value.(*cacheEntry).size
+	c.lru.Remove(element)
+	delete(c.entries, name)
+}
@@ -0,0 +1,121 @@
+package watcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// compression - compressed files codec
+type compression struct {
+	extension  string
+	magic      []byte
+	decompress func(b []byte) ([]byte, error)
+}
+
+var compressions = []*compression{
+	{extension: ".gz", magic: []byte{0x1f, 0x8b}, decompress: gunzip},
+	{extension: ".zst", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, decompress: unzstd},
+}
+
+// logicalName - returns file name without compression extension, so foo.txt.gz is shown as foo.txt
+func logicalName(name string) string {
+	if c := compressionByName(name); c != nil {
+		return name[:len(name)-len(c.extension)]
+	}
+
+	return name
+}
+
+// fileNames - returns names of the files, which are shown by the logical name, in the order of preference:
+// uncompressed file is preferred over compressed ones, if several of them exist
+func fileNames(name string) []string {
+	names := []string{name}
+	for _, c := range compressions {
+		names = append(names, name+c.extension)
+	}
+
+	return names
+}
+
+// fileRank - returns preference of the file among files with the same logical name, lower rank is preferred
+func fileRank(name string) int {
+	c := compressionByName(name)
+
+	for i, compression := range compressions {
+		if c == compression {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// compressionByName - returns codec by the file extension
+func compressionByName(name string) *compression {
+	ext := strings.ToLower(path.Ext(name))
+
+	for _, c := range compressions {
+		if c.extension == ext {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// compressionByMagic - returns codec by the magic bytes of the file content
+func compressionByMagic(b []byte) *compression {
+	for _, c := range compressions {
+		if bytes.HasPrefix(b, c.magic) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// decompress - decompresses file content, detected by magic bytes or file extension,
+// returns false, if file is not compressed
+func decompress(name string, b []byte) ([]byte, bool, error) {
+	c := compressionByMagic(b)
+	if c == nil {
+		c = compressionByName(name)
+	}
+
+	if c == nil {
+		return b, false, nil
+	}
+
+	data, err := c.decompress(b)
+	if err != nil {
+		return nil, true, errors.Wrapf(err, "decompressing file %q failed", name)
+	}
+
+	return data, true, nil
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func unzstd(b []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+
+	defer decoder.Close()
+	return decoder.DecodeAll(b, nil)
+}
@@ -0,0 +1,172 @@
+package watcher
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+const (
+	// CSVFormat - name of the comma separated format
+	CSVFormat = "csv"
+
+	// TSVFormat - name of the tab separated format
+	TSVFormat = "tsv"
+)
+
+// csvParser - parser for delimited files with header row and quoted fields,
+// quoted fields could not contain line breaks
+type csvParser struct {
+	delimiter rune
+	comment   string
+	x         *XParser
+}
+
+// NewCSVParser - returns new comma separated files parser
+func NewCSVParser(cfg config.CSVParser, xAxis config.XAxis) (Parser, error) {
+	return newDelimitedParser(cfg, xAxis, ',')
+}
+
+// NewTSVParser - returns new tab separated files parser
+func NewTSVParser(cfg config.CSVParser, xAxis config.XAxis) (Parser, error) {
+	return newDelimitedParser(cfg, xAxis, '\t')
+}
+
+func newDelimitedParser(cfg config.CSVParser, xAxis config.XAxis, defaultDelimiter rune) (Parser, error) {
+	x, err := NewXParser(xAxis)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Delimiter == "" {
+		return &csvParser{delimiter: defaultDelimiter, comment: cfg.Comment, x: x}, nil
+	}
+
+	delimiter, err := parseDelimiter(cfg.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csvParser{delimiter: delimiter, comment: cfg.Comment, x: x}, nil
+}
+
+func (p *csvParser) Parse(b []byte) (*FileData, error) {
+	return p.parse(b, nil, 1, true), nil
+}
+
+func (p *csvParser) ParseTail(b []byte, columns []string, line int) (*FileData, error) {
+	return p.parse(b, columns, line, false), nil
+}
+
+func (p *csvParser) parse(b []byte, columns []string, line int, withHeader bool) *FileData {
+	res := NewFileData(columns).WithXParser(p.x)
+
+	for i, row := range splitLines(b) {
+		trimmedRow := strings.TrimSpace(row)
+		if trimmedRow == "" || p.comment != "" && strings.HasPrefix(trimmedRow, p.comment) {
+			continue
+		}
+
+		record, err := splitRecord(row, p.delimiter)
+		if err != nil {
+			res.Warn(line+i, row, err.Error())
+			continue
+		}
+
+		if withHeader {
+			withHeader = false
+
+			if !p.isDataRecord(record) {
+				res.Columns = trimFields(record)
+				continue
+			}
+		}
+
+		res.AppendRow(line+i, row, record)
+	}
+
+	return res
+}
+
+// splitRecord - splits delimited line into fields,
+// field could be quoted, quote inside of quoted field is escaped by doubling
+func splitRecord(line string, delimiter rune) ([]string, error) {
+	fields := make([]string, 0, 4)
+	field := make([]byte, 0, 16)
+	quoted, wasQuoted := false, false
+
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+
+		switch {
+		case quoted && r == '"':
+			if strings.HasPrefix(line[i+size:], `"`) {
+				field = append(field, '"')
+				size++
+			} else {
+				quoted = false
+			}
+		case quoted:
+			field = append(field, line[i:i+size]...)
+		case r == '"' && !wasQuoted && strings.TrimSpace(string(field)) == "":
+			quoted, wasQuoted = true, true
+			field = field[:0]
+		case r == delimiter:
+			fields = append(fields, string(field))
+			field = field[:0]
+			wasQuoted = false
+		default:
+			field = append(field, line[i:i+size]...)
+		}
+
+		i += size
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quoted field")
+	}
+
+	return append(fields, string(field)), nil
+}
+
+func parseDelimiter(delimiter string) (rune, error) {
+	if delimiter == `\t` || delimiter == "tab" {
+		return '\t', nil
+	}
+
+	r, size := utf8.DecodeRuneInString(delimiter)
+	if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return 0, errors.Errorf("bad delimiter %q", delimiter)
+	}
+
+	return r, nil
+}
+
+// isDataRecord - checks, if record is a data row: x is parsed and all of y values are numbers
+func (p *csvParser) isDataRecord(record []string) bool {
+	if _, _, err := p.x.Parse(record[0]); err != nil {
+		return false
+	}
+
+	for _, field := range record[1:] {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func trimFields(fields []string) []string {
+	res := make([]string, 0, len(fields))
+
+	for _, field := range fields {
+		res = append(res, strings.TrimSpace(field))
+	}
+
+	return res
+}
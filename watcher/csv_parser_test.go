@@ -0,0 +1,134 @@
+package watcher
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lillilli/graphex/config"
+)
+
+func TestCSVParserParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.CSVParser
+		tsv     bool
+		content string
+		columns []string
+		values  [][2]float64
+	}{
+		{name: "header", content: "step, \"loss, train\"\n1,2\n2,3\n", columns: []string{"step", "loss, train"}, values: [][2]float64{{1, 2}, {2, 3}}},
+		{name: "no header", content: "1,2\n2,3\n", values: [][2]float64{{1, 2}, {2, 3}}},
+		{name: "comments", cfg: config.CSVParser{Comment: "#"}, content: "# run\nx,y\n1,2\n  # note\n2,3\n", columns: []string{"x", "y"}, values: [][2]float64{{1, 2}, {2, 3}}},
+		{name: "bad rows", content: "x,y\n1,a\n2\n3,4\n", columns: []string{"x", "y"}, values: [][2]float64{{3, 4}}},
+		{name: "tsv", tsv: true, content: "x\ty\n1\t2\n", columns: []string{"x", "y"}, values: [][2]float64{{1, 2}}},
+		{name: "multiple series", content: "x,a,b\n1,2,\n2,,3\n3,4,5\n", columns: []string{"x", "a", "b"}, values: [][2]float64{{1, 2}, {3, 4}}},
+		{name: "custom delimiter", cfg: config.CSVParser{Delimiter: ";"}, content: "x;y\n1;2\n", columns: []string{"x", "y"}, values: [][2]float64{{1, 2}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newParser := NewCSVParser
+			if test.tsv {
+				newParser = NewTSVParser
+			}
+
+			p, err := newParser(test.cfg, config.XAxis{Type: "auto", Location: "UTC"})
+			if err != nil {
+				t.Fatalf("creating parser failed: %v", err)
+			}
+
+			data, err := p.Parse([]byte(test.content))
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+
+			if !reflect.DeepEqual(data.Columns, test.columns) {
+				t.Errorf("expected columns %q, got %q", test.columns, data.Columns)
+			}
+
+			if points := data.Points(); !reflect.DeepEqual(points, test.values) {
+				t.Errorf("expected points %v, got %v", test.values, points)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		delimiter string
+		expected  rune
+		err       bool
+	}{
+		{delimiter: ";", expected: ';'},
+		{delimiter: `\t`, expected: '\t'},
+		{delimiter: "tab", expected: '\t'},
+		{delimiter: "§", expected: '§'},
+		{delimiter: `"`, err: true},
+		{delimiter: ",,", err: true},
+		{delimiter: "\n", err: true},
+	}
+
+	for _, test := range tests {
+		r, err := parseDelimiter(test.delimiter)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error, got %q", test.delimiter, r)
+			}
+
+			continue
+		}
+
+		if err != nil || r != test.expected {
+			t.Errorf("%q: expected %q, got %q (%v)", test.delimiter, test.expected, r, err)
+		}
+	}
+}
+
+func TestSplitRecord(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		delimiter rune
+		fields    []string
+		err       bool
+	}{
+		{name: "plain", line: "1,2,3", delimiter: ',', fields: []string{"1", "2", "3"}},
+		{name: "empty line", line: "", delimiter: ',', fields: []string{""}},
+		{name: "empty fields", line: ",,", delimiter: ',', fields: []string{"", "", ""}},
+		{name: "tab", line: "1\t2", delimiter: '\t', fields: []string{"1", "2"}},
+		{name: "multibyte delimiter", line: "1§2", delimiter: '§', fields: []string{"1", "2"}},
+		{name: "quoted delimiter", line: `"a,b",2`, delimiter: ',', fields: []string{"a,b", "2"}},
+		{name: "quoted after spaces", line: `  "a,b",2`, delimiter: ',', fields: []string{"a,b", "2"}},
+		{name: "doubled quote", line: `"say ""hi""",1`, delimiter: ',', fields: []string{`say "hi"`, "1"}},
+		{name: "only doubled quote", line: `"""",1`, delimiter: ',', fields: []string{`"`, "1"}},
+		{name: "empty quoted", line: `"",1`, delimiter: ',', fields: []string{"", "1"}},
+		{name: "quote inside unquoted field", line: `a"b,1`, delimiter: ',', fields: []string{`a"b`, "1"}},
+		{name: "backslash is not escape", line: `"a\"",1`, delimiter: ',', err: true},
+		{name: "text after closing quote", line: `"a"b,1`, delimiter: ',', fields: []string{"ab", "1"}},
+		{name: "second quote after closing quote", line: `"a" "b",1`, delimiter: ',', fields: []string{`a "b"`, "1"}},
+		{name: "unterminated", line: `"a,1`, delimiter: ',', err: true},
+		{name: "unterminated after doubled quote", line: `"a"",1`, delimiter: ',', err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := splitRecord(test.line, test.delimiter)
+
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error, got %q", fields)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Fatalf("expected %q, got %q", test.fields, fields)
+			}
+		})
+	}
+}
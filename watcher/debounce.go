@@ -0,0 +1,97 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// updatesQueueSize - size of the coalesced updates queue
+const updatesQueueSize = 1024
+
+// debouncer - coalesces bursts of file events,
+// update is flushed, when there were no events for the quiet period or max latency is exceeded
+type debouncer struct {
+	quietPeriod time.Duration
+	maxLatency  time.Duration
+
+	pending map[string]*pendingUpdate
+	queue   chan *pendingUpdate
+	sync.Mutex
+}
+
+// pendingUpdate - coalesced file update, op contains all operations of the burst
+type pendingUpdate struct {
+	name     string
+	fullPath string
+	op       fsnotify.Op
+
+	first   time.Time
+	timer   *time.Timer
+	flushed bool
+}
+
+func newDebouncer(quietPeriod, maxLatency time.Duration) *debouncer {
+	return &debouncer{
+		quietPeriod: quietPeriod,
+		maxLatency:  maxLatency,
+		pending:     make(map[string]*pendingUpdate),
+		queue:       make(chan *pendingUpdate, updatesQueueSize),
+	}
+}
+
+// add - adds file operation to the pending file update
+func (d *debouncer) add(name, fullPath string, op fsnotify.Op) {
+	d.Lock()
+	defer d.Unlock()
+
+	now := time.Now()
+	update, ok := d.pending[name]
+
+	if ok && !update.flushed && update.timer.Stop() {
+		update.fullPath = fullPath
+		update.op |= op
+		update.timer.Reset(d.delay(now.Sub(update.first)))
+		return
+	}
+
+	update = &pendingUpdate{name: name, fullPath: fullPath, op: op, first: now}
+	update.timer = time.AfterFunc(d.delay(0), func() { d.flush(update) })
+	d.pending[name] = update
+}
+
+// delay - returns time to wait before flush of the update, which is pending for elapsed time
+func (d *debouncer) delay(elapsed time.Duration) time.Duration {
+	if d.maxLatency <= 0 || elapsed+d.quietPeriod <= d.maxLatency {
+		return d.quietPeriod
+	}
+
+	if elapsed >= d.maxLatency {
+		return 0
+	}
+
+	return d.maxLatency - elapsed
+}
+
+func (d *debouncer) flush(update *pendingUpdate) {
+	d.Lock()
+
+	if update.flushed {
+		d.Unlock()
+		return
+	}
+
+	update.flushed = true
+	if d.pending[update.name] == update {
+		delete(d.pending, update.name)
+	}
+
+	d.Unlock()
+	d.queue <- update
+}
+
+// updates - returns channel of coalesced updates in flush order
+func (d *debouncer) updates() <-chan *pendingUpdate {
+	return d.queue
+}
@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// DerivedFormat - format of virtual files with derived series
+const DerivedFormat = "derived"
+
+// derivedFile - virtual file with series, computed by expressions over columns of the source file
+type derivedFile struct {
+	source string
+	series []*derivedSeries
+}
+
+type derivedSeries struct {
+	name string
+	expr *Expr
+}
+
+func newDerivedFile(cfg config.DerivedFile) (*derivedFile, error) {
+	if cfg.Source == "" {
+		return nil, errors.New("no source file")
+	}
+
+	if _, err := path.Match(cfg.Source, ""); err != nil {
+		return nil, errors.Wrapf(err, "bad source pattern %q", cfg.Source)
+	}
+
+	if len(cfg.Series) == 0 {
+		return nil, errors.New("no series")
+	}
+
+	f := &derivedFile{source: cfg.Source, series: make([]*derivedSeries, 0, len(cfg.Series))}
+
+	for i, series := range cfg.Series {
+		expr, err := CompileExpr(series.Expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compiling expression %q failed", series.Expr)
+		}
+
+		name := series.Name
+		if name == "" {
+			name = series.Expr
+		}
+
+		if name == "" {
+			return nil, errors.Errorf("series %d has no expression", i+1)
+		}
+
+		f.series = append(f.series, &derivedSeries{name: name, expr: expr})
+	}
+
+	return f, nil
+}
+
+func (f *derivedFile) Patterns() []string {
+	return []string{f.source}
+}
+
+func (f *derivedFile) Format() string {
+	return DerivedFormat
+}
+
+// Compute - evaluates series expressions over the source file data, x values are taken from the source,
+// the first file is used, if source pattern matches several files
+func (f *derivedFile) Compute(sources []*FileData, names []string) (*FileData, error) {
+	source := sources[0]
+
+	xName := "x"
+	if len(source.Columns) != 0 {
+		xName = source.Columns[0]
+	}
+
+	columns := []string{xName}
+	for _, series := range f.series {
+		columns = append(columns, series.name)
+	}
+
+	res := NewFileData(columns)
+	res.X = append(res.X, source.X...)
+	res.XAxis = source.XAxis
+
+	for _, series := range f.series {
+		values, err := series.expr.Eval(source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "computing series %q failed", series.name)
+		}
+
+		// column reference returns source values, so they are copied
+		values = append(make([]float64, 0, len(values)), values...)
+		res.Series = append(res.Series, &Series{Name: series.name, Values: values})
+	}
+
+	return res, nil
+}
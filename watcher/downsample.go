@@ -0,0 +1,310 @@
+package watcher
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// LTTBDownsampling - largest triangle three buckets algorithm, keeps visual shape of series
+	LTTBDownsampling = "lttb"
+
+	// MinMaxDownsampling - min and max values of every bucket, keeps envelope of series
+	MinMaxDownsampling = "minmax"
+
+	// NthDownsampling - every n-th point
+	NthDownsampling = "nth"
+)
+
+// Downsampler - reduces file data to the target points count,
+// appended points are reduced with the same density as the last full data, so they could be delayed,
+// until there are enough of them for one output point
+type Downsampler struct {
+	method string
+	target int
+
+	ratio   int
+	pending *FileData
+	sync.Mutex
+}
+
+// NewDownsampler - returns new downsampler, method is LTTB by default
+func NewDownsampler(method string, target int) (*Downsampler, error) {
+	switch method {
+	case "":
+		method = LTTBDownsampling
+	case LTTBDownsampling, MinMaxDownsampling, NthDownsampling:
+	default:
+		return nil, errors.Errorf("unknown downsampling method %q", method)
+	}
+
+	if target <= 0 {
+		return nil, errors.Errorf("bad target points count %d", target)
+	}
+
+	return &Downsampler{method: method, target: target, ratio: 1}, nil
+}
+
+// Reduce - reduces full file data, pending appended points are dropped
+func (s *Downsampler) Reduce(data *FileData) *FileData {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pending = nil
+	s.ratio = 1
+
+	if data.Len() <= s.target {
+		return data
+	}
+
+	s.ratio = (data.Len() + s.target - 1) / s.target
+	return Downsample(data, s.method, s.target)
+}
+
+// ReduceTail - reduces appended points, returns data without points, if there are not enough of them yet
+func (s *Downsampler) ReduceTail(tail *FileData) *FileData {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.ratio <= 1 {
+		return tail
+	}
+
+	if s.pending == nil {
+		s.pending = NewFileData(tail.Columns)
+	}
+
+	// merge copies tail arrays, so tail, which is shared between subscribers, is not changed
+	s.pending = s.pending.Merge(tail)
+	s.pending.Warnings, s.pending.WarningsCount = nil, 0
+
+	count := s.pending.Len() / s.ratio
+	if count == 0 {
+		res := NewFileData(tail.Columns)
+		res.XAxis, res.Version = tail.XAxis, tail.Version
+		return res
+	}
+
+	ready := s.pending.slice(0, count*s.ratio)
+	s.pending = s.pending.slice(count*s.ratio, s.pending.Len())
+
+	res := Downsample(ready, s.method, count)
+	res.Version = tail.Version
+	return res
+}
+
+// Downsample - returns file data, reduced to about target points by the method,
+// points of all series are kept at shared x values, so every series gets its part of the target
+func Downsample(data *FileData, method string, target int) *FileData {
+	if target <= 0 || data.Len() <= target {
+		return data
+	}
+
+	if method == NthDownsampling || len(data.Series) == 0 {
+		return data.pick(nthIndexes(data.Len(), target))
+	}
+
+	seriesTarget := target / len(data.Series)
+	if seriesTarget < 1 {
+		seriesTarget = 1
+	}
+
+	selected := make(map[int]bool)
+
+	for _, series := range data.Series {
+		var indexes []int
+
+		if method == MinMaxDownsampling {
+			indexes = minMaxIndexes(series.Values, seriesTarget)
+		} else {
+			indexes = lttbIndexes(data.X, series.Values, seriesTarget)
+		}
+
+		for _, i := range indexes {
+			selected[i] = true
+		}
+	}
+
+	indexes := make([]int, 0, len(selected))
+	for i := range selected {
+		indexes = append(indexes, i)
+	}
+
+	sort.Ints(indexes)
+	return data.pick(indexes)
+}
+
+// nthIndexes - returns every n-th index, so there are not more than target of them
+func nthIndexes(n, target int) []int {
+	step := (n + target - 1) / target
+	indexes := make([]int, 0, target)
+
+	for i := 0; i < n; i += step {
+		indexes = append(indexes, i)
+	}
+
+	return indexes
+}
+
+// minMaxIndexes - returns indexes of min and max values of every bucket, NaN values are skipped
+func minMaxIndexes(values []float64, target int) []int {
+	valid := validIndexes(values)
+
+	buckets := target / 2
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	if len(valid) <= buckets*2 {
+		return valid
+	}
+
+	indexes := make([]int, 0, buckets*2)
+	bucketSize := float64(len(valid)) / float64(buckets)
+
+	for b := 0; b < buckets; b++ {
+		start, end := int(float64(b)*bucketSize), int(float64(b+1)*bucketSize)
+		if end > len(valid) {
+			end = len(valid)
+		}
+
+		minIndex, maxIndex := valid[start], valid[start]
+
+		for _, i := range valid[start:end] {
+			if values[i] < values[minIndex] {
+				minIndex = i
+			}
+
+			if values[i] > values[maxIndex] {
+				maxIndex = i
+			}
+		}
+
+		if minIndex > maxIndex {
+			minIndex, maxIndex = maxIndex, minIndex
+		}
+
+		indexes = append(indexes, minIndex)
+		if maxIndex != minIndex {
+			indexes = append(indexes, maxIndex)
+		}
+	}
+
+	return indexes
+}
+
+// lttbIndexes - returns indexes, chosen by largest triangle three buckets algorithm, NaN values are skipped
+func lttbIndexes(x, values []float64, target int) []int {
+	valid := validIndexes(values)
+
+	if len(valid) <= target {
+		return valid
+	}
+
+	if target < 3 {
+		indexes := make([]int, 0, target)
+		for _, i := range nthIndexes(len(valid), target) {
+			indexes = append(indexes, valid[i])
+		}
+
+		return indexes
+	}
+
+	indexes := make([]int, 0, target)
+	indexes = append(indexes, valid[0])
+
+	// first and last points are always kept, other points are split into target - 2 buckets
+	bucketSize := float64(len(valid)-2) / float64(target-2)
+	prev := valid[0]
+
+	for b := 0; b < target-2; b++ {
+		start, end := int(float64(b)*bucketSize)+1, int(float64(b+1)*bucketSize)+1
+		nextStart, nextEnd := end, int(float64(b+2)*bucketSize)+1
+		if nextEnd > len(valid) {
+			nextEnd = len(valid)
+		}
+
+		avgX, avgY := 0.0, 0.0
+		for _, i := range valid[nextStart:nextEnd] {
+			avgX += x[i]
+			avgY += values[i]
+		}
+
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		maxArea, chosen := -1.0, valid[start]
+
+		for _, i := range valid[start:end] {
+			area := math.Abs((x[prev]-avgX)*(values[i]-values[prev]) - (x[prev]-x[i])*(avgY-values[prev]))
+			if area > maxArea {
+				maxArea, chosen = area, i
+			}
+		}
+
+		indexes = append(indexes, chosen)
+		prev = chosen
+	}
+
+	return append(indexes, valid[len(valid)-1])
+}
+
+// validIndexes - returns indexes of not NaN values
+func validIndexes(values []float64) []int {
+	indexes := make([]int, 0, len(values))
+
+	for i, value := range values {
+		if !math.IsNaN(value) {
+			indexes = append(indexes, i)
+		}
+	}
+
+	return indexes
+}
+
+// pick - returns file data with points at indexes, warnings are not copied
+func (d *FileData) pick(indexes []int) *FileData {
+	res := &FileData{
+		Columns: d.Columns,
+		X:       make([]float64, 0, len(indexes)),
+		Series:  make([]*Series, 0, len(d.Series)),
+		XAxis:   d.XAxis,
+		Version: d.Version,
+	}
+
+	for _, i := range indexes {
+		res.X = append(res.X, d.X[i])
+	}
+
+	for _, series := range d.Series {
+		values := make(SeriesValues, 0, len(indexes))
+		for _, i := range indexes {
+			values = append(values, series.Values[i])
+		}
+
+		res.Series = append(res.Series, &Series{Name: series.Name, Values: values})
+	}
+
+	return res
+}
+
+// slice - returns copy of file data with points from start to end, warnings are not copied
+func (d *FileData) slice(start, end int) *FileData {
+	res := &FileData{
+		Columns: d.Columns,
+		X:       append(make([]float64, 0, end-start), d.X[start:end]...),
+		Series:  make([]*Series, 0, len(d.Series)),
+		XAxis:   d.XAxis,
+		Version: d.Version,
+	}
+
+	for _, series := range d.Series {
+		values := append(make(SeriesValues, 0, end-start), series.Values[start:end]...)
+		res.Series = append(res.Series, &Series{Name: series.Name, Values: values})
+	}
+
+	return res
+}
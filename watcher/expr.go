@@ -0,0 +1,664 @@
+package watcher
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxExprLength - max length of the expression source
+	maxExprLength = 1024
+
+	// maxExprDepth - max nesting depth of the expression
+	maxExprDepth = 32
+
+	// maxRollingWindow - max points count of rolling window
+	maxRollingWindow = 1000000
+)
+
+// Expr - compiled expression over file columns, it is evaluated for all of the points at once:
+// columns are referenced by name (x or the first column name is x values, col("name") for names with spaces),
+// numbers, pi and e constants, + - * / % ^ operators, math functions, rolling windows, diff and cumsum are supported
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+// CompileExpr - parses expression
+func CompileExpr(source string) (*Expr, error) {
+	if len(source) > maxExprLength {
+		return nil, errors.Errorf("expression is longer than %d", maxExprLength)
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errors.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+
+	return &Expr{source: source, root: root}, nil
+}
+
+// String - returns expression source
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval - returns expression values for every point of the file data
+func (e *Expr) Eval(data *FileData) ([]float64, error) {
+	v, err := e.root.eval(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.vector == nil {
+		return broadcast(v, data.Len()), nil
+	}
+
+	return v.vector, nil
+}
+
+// exprValue - vector of values or scalar, if vector is nil
+type exprValue struct {
+	scalar float64
+	vector []float64
+}
+
+func broadcast(v exprValue, n int) []float64 {
+	if v.vector != nil {
+		return v.vector
+	}
+
+	res := make([]float64, n)
+	for i := range res {
+		res[i] = v.scalar
+	}
+
+	return res
+}
+
+type exprNode interface {
+	eval(data *FileData) (exprValue, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(*FileData) (exprValue, error) {
+	return exprValue{scalar: float64(n)}, nil
+}
+
+type columnNode string
+
+func (n columnNode) eval(data *FileData) (exprValue, error) {
+	name := string(n)
+
+	if name == "x" || len(data.Columns) != 0 && data.Columns[0] == name {
+		return exprValue{vector: data.X}, nil
+	}
+
+	for _, series := range data.Series {
+		if series.Name == name {
+			return exprValue{vector: series.Values}, nil
+		}
+	}
+
+	return exprValue{}, errors.Errorf("unknown column %q", name)
+}
+
+type unaryNode struct {
+	arg exprNode
+}
+
+func (n unaryNode) eval(data *FileData) (exprValue, error) {
+	v, err := n.arg.eval(data)
+	if err != nil {
+		return v, err
+	}
+
+	return mapValue(v, func(a float64) float64 { return -a }), nil
+}
+
+type binaryNode struct {
+	op          byte
+	left, right exprNode
+}
+
+func (n binaryNode) eval(data *FileData) (exprValue, error) {
+	left, err := n.left.eval(data)
+	if err != nil {
+		return left, err
+	}
+
+	right, err := n.right.eval(data)
+	if err != nil {
+		return right, err
+	}
+
+	return zipValues(left, right, data.Len(), binaryOps[n.op]), nil
+}
+
+var binaryOps = map[byte]func(a, b float64) float64{
+	'+': func(a, b float64) float64 { return a + b },
+	'-': func(a, b float64) float64 { return a - b },
+	'*': func(a, b float64) float64 { return a * b },
+	'/': func(a, b float64) float64 { return a / b },
+	'%': math.Mod,
+	'^': math.Pow,
+}
+
+type callNode struct {
+	name string
+	fn   *exprFunc
+	args []exprNode
+}
+
+func (n callNode) eval(data *FileData) (exprValue, error) {
+	args := make([]exprValue, 0, len(n.args))
+
+	for _, arg := range n.args {
+		v, err := arg.eval(data)
+		if err != nil {
+			return v, err
+		}
+
+		args = append(args, v)
+	}
+
+	v, err := n.fn.call(args, data.Len())
+	if err != nil {
+		return v, errors.Wrapf(err, "%s failed", n.name)
+	}
+
+	return v, nil
+}
+
+// exprFunc - expression function with fixed arguments count
+type exprFunc struct {
+	args int
+	call func(args []exprValue, n int) (exprValue, error)
+}
+
+var exprFuncs = map[string]*exprFunc{
+	"abs":   mathFunc(math.Abs),
+	"sqrt":  mathFunc(math.Sqrt),
+	"exp":   mathFunc(math.Exp),
+	"log":   mathFunc(math.Log),
+	"log2":  mathFunc(math.Log2),
+	"log10": mathFunc(math.Log10),
+	"sin":   mathFunc(math.Sin),
+	"cos":   mathFunc(math.Cos),
+	"tan":   mathFunc(math.Tan),
+	"asin":  mathFunc(math.Asin),
+	"acos":  mathFunc(math.Acos),
+	"atan":  mathFunc(math.Atan),
+	"floor": mathFunc(math.Floor),
+	"ceil":  mathFunc(math.Ceil),
+	"round": mathFunc(math.Round),
+	"min":   mathFunc2(math.Min),
+	"max":   mathFunc2(math.Max),
+	"pow":   mathFunc2(math.Pow),
+	"atan2": mathFunc2(math.Atan2),
+
+	"diff":   vectorFunc(diff),
+	"cumsum": vectorFunc(cumsum),
+
+	"rolling_mean": rollingFunc(rollingMoments(func(m *moments) float64 { return m.mean })),
+	"rolling_sum":  rollingFunc(rollingMoments(func(m *moments) float64 { return m.sum })),
+	"rolling_std":  rollingFunc(rollingMoments((*moments).std)),
+	"rolling_min":  rollingFunc(rollingExtremum(func(a, b float64) bool { return a <= b })),
+	"rolling_max":  rollingFunc(rollingExtremum(func(a, b float64) bool { return a >= b })),
+}
+
+var exprConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+func mathFunc(f func(float64) float64) *exprFunc {
+	return &exprFunc{args: 1, call: func(args []exprValue, n int) (exprValue, error) {
+		return mapValue(args[0], f), nil
+	}}
+}
+
+func mathFunc2(f func(a, b float64) float64) *exprFunc {
+	return &exprFunc{args: 2, call: func(args []exprValue, n int) (exprValue, error) {
+		return zipValues(args[0], args[1], n, f), nil
+	}}
+}
+
+func vectorFunc(f func(values []float64) []float64) *exprFunc {
+	return &exprFunc{args: 1, call: func(args []exprValue, n int) (exprValue, error) {
+		return exprValue{vector: f(broadcast(args[0], n))}, nil
+	}}
+}
+
+// rollingFunc - returns function of the values and window size (points count),
+// f reduces not NaN values of the last window points, result is NaN, if there are no such values
+func rollingFunc(f func(values []float64, size int) []float64) *exprFunc {
+	return &exprFunc{args: 2, call: func(args []exprValue, n int) (exprValue, error) {
+		if args[1].vector != nil {
+			return exprValue{}, errors.New("window size should be a number")
+		}
+
+		size := int(args[1].scalar)
+		if float64(size) != args[1].scalar || size < 1 || size > maxRollingWindow {
+			return exprValue{}, errors.Errorf("bad window size %v", args[1].scalar)
+		}
+
+		return exprValue{vector: f(broadcast(args[0], n), size)}, nil
+	}}
+}
+
+// rollingMoments - returns rolling function, computed by moments of the window values,
+// infinite values are skipped as NaN, so they do not turn results of the next windows into NaN
+func rollingMoments(f func(m *moments) float64) func(values []float64, size int) []float64 {
+	return func(values []float64, size int) []float64 {
+		res := make([]float64, len(values))
+		m := &moments{}
+
+		for i, v := range values {
+			if i >= size && finite(values[i-size]) {
+				m.remove(values[i-size])
+			}
+
+			if finite(v) {
+				m.add(v)
+			}
+
+			res[i] = math.NaN()
+			if m.count > 0 {
+				res[i] = f(m)
+			}
+		}
+
+		return res
+	}
+}
+
+// rollingExtremum - returns rolling min or max function, better(a, b) reports, if a is not worse than b,
+// indexes of window values are kept in the monotonic queue, so the first one is the extremum
+func rollingExtremum(better func(a, b float64) bool) func(values []float64, size int) []float64 {
+	return func(values []float64, size int) []float64 {
+		res := make([]float64, len(values))
+		queue := make([]int, 0, size)
+
+		for i, v := range values {
+			if len(queue) != 0 && queue[0] <= i-size {
+				queue = queue[1:]
+			}
+
+			if !math.IsNaN(v) {
+				for len(queue) != 0 && better(v, values[queue[len(queue)-1]]) {
+					queue = queue[:len(queue)-1]
+				}
+
+				queue = append(queue, i)
+			}
+
+			res[i] = math.NaN()
+			if len(queue) != 0 {
+				res[i] = values[queue[0]]
+			}
+		}
+
+		return res
+	}
+}
+
+func mapValue(v exprValue, f func(float64) float64) exprValue {
+	if v.vector == nil {
+		return exprValue{scalar: f(v.scalar)}
+	}
+
+	res := make([]float64, len(v.vector))
+	for i, a := range v.vector {
+		res[i] = f(a)
+	}
+
+	return exprValue{vector: res}
+}
+
+func zipValues(a, b exprValue, n int, f func(a, b float64) float64) exprValue {
+	if a.vector == nil && b.vector == nil {
+		return exprValue{scalar: f(a.scalar, b.scalar)}
+	}
+
+	left, right := broadcast(a, n), broadcast(b, n)
+	res := make([]float64, n)
+
+	for i := range res {
+		res[i] = f(left[i], right[i])
+	}
+
+	return exprValue{vector: res}
+}
+
+// diff - returns differences between neighbour values, first value is NaN
+func diff(values []float64) []float64 {
+	res := make([]float64, len(values))
+
+	for i := range values {
+		res[i] = math.NaN()
+		if i > 0 {
+			res[i] = values[i] - values[i-1]
+		}
+	}
+
+	return res
+}
+
+// cumsum - returns cumulative sums of values, NaN values are skipped
+func cumsum(values []float64) []float64 {
+	res := make([]float64, len(values))
+	total := 0.0
+
+	for i, v := range values {
+		if math.IsNaN(v) {
+			res[i] = math.NaN()
+			continue
+		}
+
+		total += v
+		res[i] = total
+	}
+
+	return res
+}
+
+const (
+	tokenEOF = iota
+	tokenNumber
+	tokenIdent
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// tokenize - splits expression into numbers, identifiers, quoted strings and operators
+func tokenize(source string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(source); {
+		c := source[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case isDigit(c) || c == '.':
+			start := i
+			i = scanNumber(source, i)
+			tokens = append(tokens, token{kind: tokenNumber, text: source[start:i], pos: start})
+
+		case isLetter(c):
+			start := i
+			for i < len(source) && (isLetter(source[i]) || isDigit(source[i])) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenIdent, text: source[start:i], pos: start})
+
+		case c == '"':
+			end := strings.IndexByte(source[i+1:], '"')
+			if end < 0 {
+				return nil, errors.Errorf("unterminated string at %d", i)
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: source[i+1 : i+1+end], pos: i})
+			i += end + 2
+
+		case strings.IndexByte("+-*/%^(),", c) >= 0:
+			tokens = append(tokens, token{kind: tokenOp, text: string(c), pos: i})
+			i++
+
+		default:
+			return nil, errors.Errorf("unexpected %q at %d", c, i)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+// scanNumber - returns end of the number, which starts at i: digits with optional dot and exponent
+func scanNumber(source string, i int) int {
+	for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+		i++
+	}
+
+	if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+		j := i + 1
+		if j < len(source) && (source[j] == '+' || source[j] == '-') {
+			j++
+		}
+
+		if j < len(source) && isDigit(source[j]) {
+			for i = j; i < len(source) && isDigit(source[i]); i++ {
+			}
+		}
+	}
+
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// exprParser - recursive descent parser of expressions
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *exprParser) expect(op string) error {
+	if t := p.next(); t.kind != tokenOp || t.text != op {
+		return errors.Errorf("expected %q at %d", op, t.pos)
+	}
+
+	return nil
+}
+
+// parseExpr - parses sum of terms
+func (p *exprParser) parseExpr(depth int) (exprNode, error) {
+	if depth > maxExprDepth {
+		return nil, errors.New("expression is too deep")
+	}
+
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for t := p.peek(); t.kind == tokenOp && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.next()
+
+		right, err := p.parseTerm(depth)
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{op: t.text[0], left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseTerm - parses product of factors
+func (p *exprParser) parseTerm(depth int) (exprNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	for t := p.peek(); t.kind == tokenOp && (t.text == "*" || t.text == "/" || t.text == "%"); t = p.peek() {
+		p.next()
+
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+
+		left = binaryNode{op: t.text[0], left: left, right: right}
+	}
+
+	return left, nil
+}
+
+// parseUnary - parses negation and power, power is right associative and binds tighter than negation
+func (p *exprParser) parseUnary(depth int) (exprNode, error) {
+	if depth > maxExprDepth {
+		return nil, errors.New("expression is too deep")
+	}
+
+	if t := p.peek(); t.kind == tokenOp && t.text == "-" {
+		p.next()
+
+		arg, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return unaryNode{arg: arg}, nil
+	}
+
+	base, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokenOp && t.text == "^" {
+		p.next()
+
+		exponent, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		return binaryNode{op: '^', left: base, right: exponent}, nil
+	}
+
+	return base, nil
+}
+
+// parsePrimary - parses number, column, constant, function call or expression in parentheses
+func (p *exprParser) parsePrimary(depth int) (exprNode, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errors.Errorf("bad number %q at %d", t.text, t.pos)
+		}
+
+		return numberNode(v), nil
+
+	case tokenIdent:
+		if next := p.peek(); next.kind == tokenOp && next.text == "(" {
+			p.next()
+			return p.parseCall(t, depth)
+		}
+
+		if v, ok := exprConstants[t.text]; ok {
+			return numberNode(v), nil
+		}
+
+		return columnNode(t.text), nil
+
+	case tokenOp:
+		if t.text == "(" {
+			node, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+
+			return node, p.expect(")")
+		}
+	}
+
+	if t.kind == tokenEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	return nil, errors.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// parseCall - parses function arguments, col("name") is a reference to the column with any name
+func (p *exprParser) parseCall(name token, depth int) (exprNode, error) {
+	if name.text == "col" {
+		arg := p.next()
+		if arg.kind != tokenString {
+			return nil, errors.Errorf("col expects quoted column name at %d", arg.pos)
+		}
+
+		return columnNode(arg.text), p.expect(")")
+	}
+
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, errors.Errorf("unknown function %q at %d", name.text, name.pos)
+	}
+
+	args := make([]exprNode, 0, fn.args)
+
+	for {
+		arg, err := p.parseExpr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+
+		if t := p.peek(); t.kind == tokenOp && t.text == "," {
+			p.next()
+			continue
+		}
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+
+		break
+	}
+
+	if len(args) != fn.args {
+		return nil, errors.Errorf("%s expects %d arguments, got %d", name.text, fn.args, len(args))
+	}
+
+	return callNode{name: name.text, fn: fn, args: args}, nil
+}
@@ -0,0 +1,183 @@
+package watcher
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// exprData - data of expressions tests, "loss" has a missing value
+var exprData = newTestData([]string{"step", "loss", "val loss"}, []float64{1, 2, 3, 4, 5},
+	SeriesValues{4, 2, nan, 1, 3}, SeriesValues{1, 2, 3, 4, 5})
+
+func evalExpr(t *testing.T, source string) []float64 {
+	t.Helper()
+
+	expr, err := CompileExpr(source)
+	if err != nil {
+		t.Fatalf("compiling %q failed: %v", source, err)
+	}
+
+	values, err := expr.Eval(exprData)
+	if err != nil {
+		t.Fatalf("evaluating %q failed: %v", source, err)
+	}
+
+	return values
+}
+
+func TestExprPrecedence(t *testing.T) {
+	tests := []struct {
+		source string
+		value  float64
+	}{
+		{source: "1 + 2 * 3", value: 7},
+		{source: "(1 + 2) * 3", value: 9},
+		{source: "10 - 4 - 3", value: 3},
+		{source: "1 - 2 + 3", value: 2},
+		{source: "8 / 4 / 2", value: 1},
+		{source: "7 % 4 * 2", value: 6},
+		{source: "2 * 3 ^ 2", value: 18},
+		{source: "2 ^ 3 ^ 2", value: 512},
+		{source: "(2 ^ 3) ^ 2", value: 64},
+		{source: "-2 ^ 2", value: -4},
+		{source: "(-2) ^ 2", value: 4},
+		{source: "2 ^ -1", value: 0.5},
+		{source: "2 ^ -1 ^ 2", value: 0.5},
+		{source: "--3", value: 3},
+		{source: "2 * -3", value: -6},
+		{source: "1e3 + 1", value: 1001},
+		{source: "1.5e-1 * 10", value: 1.5},
+		{source: ".5 + .5", value: 1},
+		{source: "pi", value: math.Pi},
+		{source: "e ^ 1", value: math.E},
+		{source: "max(1, 2) + min(3, 4) * 2", value: 8},
+		{source: "pow(2, 10) - sqrt(16) + abs(-3)", value: 1023},
+		{source: "round(2.5) + floor(-0.5) + ceil(0.1)", value: 3},
+	}
+
+	for _, test := range tests {
+		values := evalExpr(t, test.source)
+
+		expected := []float64{test.value, test.value, test.value, test.value, test.value}
+		if !equalValues(values, expected) {
+			t.Errorf("%q: expected %v, got %v", test.source, test.value, values)
+		}
+	}
+}
+
+func TestExprColumns(t *testing.T) {
+	tests := []struct {
+		source string
+		values []float64
+	}{
+		{source: "x", values: []float64{1, 2, 3, 4, 5}},
+		{source: "step", values: []float64{1, 2, 3, 4, 5}},
+		{source: "loss * 2", values: []float64{8, 4, nan, 2, 6}},
+		{source: `col("val loss") + x`, values: []float64{2, 4, 6, 8, 10}},
+		{source: `col("loss") - loss`, values: []float64{0, 0, nan, 0, 0}},
+		{source: `col("step")`, values: []float64{1, 2, 3, 4, 5}},
+		{source: "max(loss, 2)", values: []float64{4, 2, nan, 2, 3}},
+		{source: "diff(x)", values: []float64{nan, 1, 1, 1, 1}},
+		{source: "diff(loss)", values: []float64{nan, -2, nan, nan, 2}},
+		{source: "cumsum(loss)", values: []float64{4, 6, nan, 7, 10}},
+		{source: "cumsum(1)", values: []float64{1, 2, 3, 4, 5}},
+	}
+
+	for _, test := range tests {
+		if values := evalExpr(t, test.source); !equalValues(values, test.values) {
+			t.Errorf("%q: expected %v, got %v", test.source, test.values, values)
+		}
+	}
+}
+
+func TestExprRolling(t *testing.T) {
+	tests := []struct {
+		source string
+		values []float64
+	}{
+		{source: "rolling_mean(loss, 2)", values: []float64{4, 3, 2, 1, 2}},
+		{source: "rolling_sum(loss, 1)", values: []float64{4, 2, nan, 1, 3}},
+		{source: "rolling_sum(loss, 100)", values: []float64{4, 6, 6, 7, 10}},
+		{source: `rolling_std(col("val loss"), 2)`, values: []float64{0, 0.5, 0.5, 0.5, 0.5}},
+		{source: "rolling_min(loss, 3)", values: []float64{4, 2, 2, 1, 1}},
+		{source: "rolling_max(loss, 3)", values: []float64{4, 4, 4, 2, 3}},
+		{source: "rolling_max(loss, 1)", values: []float64{4, 2, nan, 1, 3}},
+		{source: "rolling_max(loss, 100)", values: []float64{4, 4, 4, 4, 4}},
+		{source: "rolling_min(-x, 2)", values: []float64{-1, -2, -3, -4, -5}},
+		{source: "rolling_max(-x, 2)", values: []float64{-1, -1, -2, -3, -4}},
+		{source: "rolling_min(2, 3)", values: []float64{2, 2, 2, 2, 2}},
+		{source: "rolling_mean(x * log(-1), 2)", values: []float64{nan, nan, nan, nan, nan}},
+		{source: "rolling_mean(loss, 1 + 1)", values: []float64{4, 3, 2, 1, 2}},
+		{source: "rolling_sum(1 / (x - 2), 2)", values: []float64{-1, -1, 1, 1.5, 5.0 / 6}},
+		{source: "rolling_mean(-1 / (x - 2), 2)", values: []float64{1, 1, -1, -0.75, -5.0 / 12}},
+		{source: "rolling_std(log(x - 3), 2)", values: []float64{nan, nan, nan, 0, math.Log(2) / 2}},
+		{source: "rolling_max(1 / (x - 2), 2)", values: []float64{-1, math.Inf(1), math.Inf(1), 1, 0.5}},
+		{source: "rolling_std(1e9 + x, 3)", values: []float64{0, 0.5, math.Sqrt(2.0 / 3), math.Sqrt(2.0 / 3), math.Sqrt(2.0 / 3)}},
+		{source: "rolling_std(1e9 + loss, 2)", values: []float64{0, 1, 0, 0, 1}},
+		{source: "rolling_mean(1e9 + x, 2) - 1e9", values: []float64{1, 1.5, 2.5, 3.5, 4.5}},
+	}
+
+	for _, test := range tests {
+		if values := evalExpr(t, test.source); !equalValues(values, test.values) {
+			t.Errorf("%q: expected %v, got %v", test.source, test.values, values)
+		}
+	}
+}
+
+func TestExprCompileErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"1 +",
+		"(1",
+		"1)",
+		"2 3",
+		"1 $ 2",
+		"*2",
+		"foo(1)",
+		"sqrt(1, 2)",
+		"max(1)",
+		"sqrt()",
+		"col(x)",
+		`col("x"`,
+		`col("x", 1)`,
+		`"abc`,
+		`"abc"`,
+		"1.2.3",
+		"2e",
+		strings.Repeat("1+", maxExprLength) + "1",
+		strings.Repeat("(", maxExprDepth+2) + "1" + strings.Repeat(")", maxExprDepth+2),
+		strings.Repeat("-", maxExprDepth+2) + "1",
+	}
+
+	for _, source := range tests {
+		if _, err := CompileExpr(source); err == nil {
+			t.Errorf("%q: expected compile error", source)
+		}
+	}
+}
+
+func TestExprEvalErrors(t *testing.T) {
+	tests := []string{
+		"unknown + 1",
+		`col("unknown")`,
+		"rolling_mean(loss, 0)",
+		"rolling_mean(loss, -1)",
+		"rolling_mean(loss, 1.5)",
+		"rolling_mean(loss, x)",
+		"rolling_max(loss, 2000000)",
+		"sqrt(rolling_sum(loss, 0))",
+	}
+
+	for _, source := range tests {
+		expr, err := CompileExpr(source)
+		if err != nil {
+			t.Errorf("compiling %q failed: %v", source, err)
+			continue
+		}
+
+		if _, err := expr.Eval(exprData); err == nil {
+			t.Errorf("%q: expected eval error", source)
+		}
+	}
+}
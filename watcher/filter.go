@@ -0,0 +1,227 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// IgnoreFileName - name of the gitignore-style file in the watch root
+const IgnoreFileName = ".graphexignore"
+
+// patternRule - gitignore-style pattern: pattern without "/" matches name at any depth,
+// pattern with "/" is relative to the root, "**" matches any dirs, trailing "/" matches only dirs
+type patternRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// patternList - list of patterns, the last matched pattern wins
+type patternList []*patternRule
+
+func newPatternList(patterns []string) (patternList, error) {
+	list := make(patternList, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		rule, err := newPatternRule(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if rule != nil {
+			list = append(list, rule)
+		}
+	}
+
+	return list, nil
+}
+
+// newPatternRule - returns rule for pattern, empty patterns and comments are skipped
+func newPatternRule(pattern string) (*patternRule, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil, nil
+	}
+
+	rule := &patternRule{}
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	if _, err := path.Match(strings.Replace(pattern, "**", "*", -1), ""); err != nil {
+		return nil, errors.Wrapf(err, "bad pattern %q", pattern)
+	}
+
+	expr := globToRegexp(pattern)
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return nil, errors.Wrapf(err, "bad pattern %q", pattern)
+	}
+
+	rule.re = re
+	return rule, nil
+}
+
+func globToRegexp(pattern string) string {
+	var expr bytes.Buffer
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			expr.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[' && strings.IndexByte(pattern[i:], ']') > 1:
+			end := strings.IndexByte(pattern[i:], ']')
+			class := pattern[i+1 : i+end]
+
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			expr.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return expr.String()
+}
+
+// match - returns, if name is matched by the list, and the match result (false for negated patterns)
+func (l patternList) match(name string, isDir bool) (matched bool, ok bool) {
+	for _, rule := range l {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.re.MatchString(name) {
+			matched, ok = !rule.negate, true
+		}
+	}
+
+	return matched, ok
+}
+
+// filter - decides, which files and dirs of the root are watched:
+// file should match include patterns (if they are set) and should not be excluded
+// by exclude patterns or ignore file in the root
+type filter struct {
+	include patternList
+	exclude patternList
+	ignore  patternList
+	sync.RWMutex
+}
+
+func newFilter(include, exclude []string) (*filter, error) {
+	includeList, err := newPatternList(include)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing include patterns failed")
+	}
+
+	excludeList, err := newPatternList(exclude)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing exclude patterns failed")
+	}
+
+	return &filter{include: includeList, exclude: excludeList}, nil
+}
+
+// loadIgnoreFile - reads ignore file, missing file means no ignore rules
+func (f *filter) loadIgnoreFile(fullPath string) error {
+	b, err := ioutil.ReadFile(fullPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	patterns := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	ignore, err := newPatternList(patterns)
+	if err != nil {
+		return err
+	}
+
+	f.Lock()
+	f.ignore = ignore
+	f.Unlock()
+	return nil
+}
+
+// allowedDir - checks, if dir should be watched
+func (f *filter) allowedDir(name string) bool {
+	if name == "." {
+		return true
+	}
+
+	return !f.excluded(name, true)
+}
+
+// allowedFile - checks, if file should be watched, file in excluded dir is excluded too
+func (f *filter) allowedFile(name string) bool {
+	if len(f.include) != 0 {
+		if matched, _ := f.include.match(name, false); !matched {
+			return false
+		}
+	}
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if f.excluded(dir, true) {
+			return false
+		}
+	}
+
+	return !f.excluded(name, false)
+}
+
+func (f *filter) excluded(name string, isDir bool) bool {
+	f.RLock()
+	defer f.RUnlock()
+
+	excluded, _ := f.exclude.match(name, isDir)
+
+	if ignored, ok := f.ignore.match(name, isDir); ok {
+		excluded = ignored
+	}
+
+	return excluded
+}
@@ -0,0 +1,88 @@
+package watcher
+
+import (
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		expr    string
+	}{
+		{pattern: "*.csv", expr: `[^/]*\.csv`},
+		{pattern: "a?c", expr: `a[^/]c`},
+		{pattern: "**/logs", expr: `(.*/)?logs`},
+		{pattern: "logs/**", expr: `logs(/.*)?`},
+		{pattern: "a/**/b", expr: `a/(.*/)?b`},
+		{pattern: "a**b", expr: `a.*b`},
+		{pattern: "[abc].txt", expr: `[abc]\.txt`},
+		{pattern: "[!abc].txt", expr: `[^abc]\.txt`},
+		{pattern: "[]", expr: `\[\]`},
+		{pattern: `\*.txt`, expr: `\*\.txt`},
+		{pattern: `a\`, expr: `a\\`},
+	}
+
+	for _, test := range tests {
+		if expr := globToRegexp(test.pattern); expr != test.expr {
+			t.Errorf("pattern %q: expected %q, got %q", test.pattern, test.expr, expr)
+		}
+	}
+}
+
+func TestPatternListMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		file     string
+		isDir    bool
+		matched  bool
+		ok       bool
+	}{
+		{name: "no patterns", file: "a.csv"},
+		{name: "comment and empty line", patterns: []string{"# a.csv", " "}, file: "a.csv"},
+		{name: "name at root", patterns: []string{"*.csv"}, file: "a.csv", matched: true, ok: true},
+		{name: "name at any depth", patterns: []string{"*.csv"}, file: "x/y/a.csv", matched: true, ok: true},
+		{name: "star does not cross dirs", patterns: []string{"x/*.csv"}, file: "x/y/a.csv"},
+		{name: "anchored pattern", patterns: []string{"x/*.csv"}, file: "x/a.csv", matched: true, ok: true},
+		{name: "anchored pattern is relative to root", patterns: []string{"x/*.csv"}, file: "y/x/a.csv"},
+		{name: "leading slash anchors", patterns: []string{"/a.csv"}, file: "x/a.csv"},
+		{name: "leading slash at root", patterns: []string{"/a.csv"}, file: "a.csv", matched: true, ok: true},
+		{name: "double star prefix at root", patterns: []string{"**/tmp"}, file: "tmp", isDir: true, matched: true, ok: true},
+		{name: "double star prefix nested", patterns: []string{"**/tmp"}, file: "a/b/tmp", isDir: true, matched: true, ok: true},
+		{name: "double star middle", patterns: []string{"a/**/c.csv"}, file: "a/c.csv", matched: true, ok: true},
+		{name: "double star middle nested", patterns: []string{"a/**/c.csv"}, file: "a/x/y/c.csv", matched: true, ok: true},
+		{name: "double star suffix", patterns: []string{"a/**"}, file: "a/x/y.csv", matched: true, ok: true},
+		{name: "trailing slash matches dir", patterns: []string{"tmp/"}, file: "x/tmp", isDir: true, matched: true, ok: true},
+		{name: "trailing slash skips file", patterns: []string{"tmp/"}, file: "x/tmp"},
+		{name: "negation", patterns: []string{"*.csv", "!keep.csv"}, file: "keep.csv", ok: true},
+		{name: "negation of other file", patterns: []string{"*.csv", "!keep.csv"}, file: "drop.csv", matched: true, ok: true},
+		{name: "last pattern wins", patterns: []string{"!keep.csv", "*.csv"}, file: "keep.csv", matched: true, ok: true},
+		{name: "negated class", patterns: []string{"[!a]*.csv"}, file: "b.csv", matched: true, ok: true},
+		{name: "negated class excludes", patterns: []string{"[!a]*.csv"}, file: "a.csv"},
+		{name: "class range", patterns: []string{"run[0-9].csv"}, file: "run7.csv", matched: true, ok: true},
+		{name: "escaped star", patterns: []string{`\*.csv`}, file: "*.csv", matched: true, ok: true},
+		{name: "escaped star is literal", patterns: []string{`\*.csv`}, file: "a.csv"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			list, err := newPatternList(test.patterns)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			matched, ok := list.match(test.file, test.isDir)
+			if matched != test.matched || ok != test.ok {
+				t.Fatalf("expected (%v, %v), got (%v, %v)", test.matched, test.ok, matched, ok)
+			}
+		})
+	}
+}
+
+func TestNewPatternRuleErrors(t *testing.T) {
+	for _, pattern := range []string{"[a", "a/[b"} {
+		if _, err := newPatternRule(pattern); err == nil {
+			t.Errorf("pattern %q: expected error", pattern)
+		}
+	}
+}
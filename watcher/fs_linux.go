@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+package watcher
+
+import "syscall"
+
+// file system magic numbers, see statfs(2)
+var networkFSTypes = map[uint32]bool{
+	0x6969:     true, // nfs
+	0x517b:     true, // smb
+	0xff534d42: true, // cifs
+	0xfe534d42: true, // smb2
+	0x65735546: true, // fuse (sshfs, docker desktop mounts)
+	0x01021997: true, // 9p (wsl, some vm shares)
+	0x6a656a63: true, // virtiofs
+}
+
+// isNetworkFS - checks, if path is on the file system, which does not deliver inotify events reliably
+func isNetworkFS(path string) bool {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false
+	}
+
+	return networkFSTypes[uint32(stat.Type)]
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+// isNetworkFS - file system type detection is supported only on linux
+func isNetworkFS(path string) bool {
+	return false
+}
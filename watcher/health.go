@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// HealthOK - watcher receives file system events
+	HealthOK = "ok"
+
+	// HealthDegraded - watcher backend failed and is being restarted, updates could be delayed
+	HealthDegraded = "degraded"
+)
+
+// Health - watcher health state
+type Health struct {
+	Status    string    `json:"status"`
+	Backend   string    `json:"backend"`
+	LastError string    `json:"last_error,omitempty"`
+	Restarts  int       `json:"restarts"`
+	Since     time.Time `json:"since"`
+}
+
+// health - thread safe health state holder
+type health struct {
+	state Health
+	sync.RWMutex
+}
+
+func newHealth(backend string) *health {
+	return &health{state: Health{Status: HealthOK, Backend: backend, Since: time.Now()}}
+}
+
+func (h *health) get() Health {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.state
+}
+
+func (h *health) degraded(err error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.state.Status = HealthDegraded
+	h.state.LastError = err.Error()
+	h.state.Since = time.Now()
+}
+
+func (h *health) restarted() {
+	h.Lock()
+	defer h.Unlock()
+
+	h.state.Status = HealthOK
+	h.state.Restarts++
+	h.state.Since = time.Now()
+}
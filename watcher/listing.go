@@ -0,0 +1,189 @@
+package watcher
+
+import (
+	"math"
+	"os"
+	"time"
+)
+
+// FileInfo - watched file metadata, data ranges are omitted, if file has no points
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Format  string    `json:"format"`
+
+	Points   int      `json:"points"`
+	XAxis    string   `json:"x_axis,omitempty"`
+	XMin     *float64 `json:"x_min,omitempty"`
+	XMax     *float64 `json:"x_max,omitempty"`
+	YMin     *float64 `json:"y_min,omitempty"`
+	YMax     *float64 `json:"y_max,omitempty"`
+	Warnings int      `json:"warnings"`
+}
+
+// RootListing - watch root with its files metadata, files are sorted by name
+type RootListing struct {
+	Name  string      `json:"name"`
+	Files []*FileInfo `json:"files"`
+}
+
+// summary - points count and data ranges of the parsed file,
+// summary of data, which was read independently of the tail state, could not be merged with appended points
+type summary struct {
+	points     int
+	xAxis      string
+	xMin, xMax float64
+	yMin, yMax float64
+	warnings   int
+	mergeable  bool
+}
+
+func newSummary(data *FileData, mergeable bool) *summary {
+	s := &summary{
+		xMin:      math.Inf(1),
+		xMax:      math.Inf(-1),
+		yMin:      math.Inf(1),
+		yMax:      math.Inf(-1),
+		mergeable: mergeable,
+	}
+
+	s.add(data)
+	return s
+}
+
+// merge - returns summary with appended points of tail
+func (s *summary) merge(tail *FileData) *summary {
+	res := *s
+	res.add(tail)
+	return &res
+}
+
+func (s *summary) add(data *FileData) {
+	s.points += data.Len()
+	s.warnings += data.WarningsCount
+
+	if s.xAxis == "" {
+		s.xAxis = data.XAxis
+	}
+
+	for _, x := range data.X {
+		s.xMin = math.Min(s.xMin, x)
+		s.xMax = math.Max(s.xMax, x)
+	}
+
+	for _, series := range data.Series {
+		for _, y := range series.Values {
+			if math.IsNaN(y) || math.IsInf(y, 0) {
+				continue
+			}
+
+			s.yMin = math.Min(s.yMin, y)
+			s.yMax = math.Max(s.yMax, y)
+		}
+	}
+}
+
+// fill - sets data ranges of the file info
+func (s *summary) fill(info *FileInfo) {
+	info.Points = s.points
+	info.XAxis = s.xAxis
+	info.Warnings = s.warnings
+
+	if s.xMin <= s.xMax {
+		info.XMin, info.XMax = floatPtr(s.xMin), floatPtr(s.xMax)
+	}
+
+	if s.yMin <= s.yMax {
+		info.YMin, info.YMax = floatPtr(s.yMin), floatPtr(s.yMax)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+// Listing - returns the watcher root with its files metadata,
+// files, which were not parsed yet, are parsed to get their data ranges
+func (w *watcher) Listing() []RootListing {
+	names := w.State()
+	files := make([]*FileInfo, 0, len(names))
+
+	for _, name := range names {
+		if info, ok := w.fileInfo(name); ok {
+			files = append(files, info)
+		}
+	}
+
+	return []RootListing{{Name: w.name, Files: files}}
+}
+
+// fileInfo - returns metadata of the file by its logical name, returns false, if file does not exist anymore
+func (w *watcher) fileInfo(name string) (*FileInfo, bool) {
+	w.RLock()
+	fileName, ok := w.files[name]
+	w.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	stat, err := os.Stat(w.fullPath(fileName))
+	if err != nil {
+		return nil, false
+	}
+
+	info := &FileInfo{Name: name, Size: stat.Size(), ModTime: stat.ModTime()}
+	_, info.Format, _ = w.parsers.Lookup(fileName)
+
+	s, ok := w.summary(name)
+	if !ok {
+		data, err := w.FileState(name)
+		if err != nil {
+			w.log.Warnf("Reading file %q for listing failed: %v", name, err)
+			return info, true
+		}
+
+		s = newSummary(data, false)
+	}
+
+	s.fill(info)
+	return info, true
+}
+
+// summary - returns summary of the last parsed file data
+func (w *watcher) summary(name string) (*summary, bool) {
+	w.RLock()
+	defer w.RUnlock()
+
+	s, ok := w.summaries[name]
+	return s, ok
+}
+
+// setSummary - sets summary of the parsed file data
+func (w *watcher) setSummary(name string, data *FileData, mergeable bool) {
+	s := newSummary(data, mergeable)
+
+	w.Lock()
+	w.summaries[name] = s
+	w.Unlock()
+}
+
+// mergeSummary - adds appended points to the file summary,
+// summary, which could not be merged, is dropped and computed again on the next listing
+func (w *watcher) mergeSummary(name string, tail *FileData) {
+	w.Lock()
+	defer w.Unlock()
+
+	s, ok := w.summaries[name]
+	if !ok {
+		return
+	}
+
+	if !s.mergeable {
+		delete(w.summaries, name)
+		return
+	}
+
+	w.summaries[name] = s.merge(tail)
+}
@@ -0,0 +1,238 @@
+package watcher
+
+import (
+	"math"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+const (
+	// ConcatMerge - points of sources one after another, series with the same name are concatenated
+	ConcatMerge = "concat"
+
+	// JoinMerge - x-aligned outer join, every series of every source is kept and named "source/series"
+	JoinMerge = "join"
+
+	// MeanMerge - x-aligned element-wise mean of series with the same name, missing values are skipped
+	MeanMerge = "mean"
+)
+
+// mergedFile - virtual file, which merges several source files
+type mergedFile struct {
+	kind    string
+	sources []string
+}
+
+func newMergedFile(cfg config.MergedFile) (*mergedFile, error) {
+	switch cfg.Kind {
+	case "":
+		cfg.Kind = ConcatMerge
+	case ConcatMerge, JoinMerge, MeanMerge:
+	default:
+		return nil, errors.Errorf("unknown merge kind %q", cfg.Kind)
+	}
+
+	if len(cfg.Sources) == 0 {
+		return nil, errors.New("no source files")
+	}
+
+	for _, pattern := range cfg.Sources {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "bad source pattern %q", pattern)
+		}
+	}
+
+	return &mergedFile{kind: cfg.Kind, sources: cfg.Sources}, nil
+}
+
+func (f *mergedFile) Patterns() []string {
+	return f.sources
+}
+
+func (f *mergedFile) Format() string {
+	return f.kind
+}
+
+func (f *mergedFile) Compute(sources []*FileData, names []string) (*FileData, error) {
+	xAxis := ""
+	for i, source := range sources {
+		if xAxis != "" && source.XAxis != "" && source.XAxis != xAxis {
+			return nil, errors.Errorf("x axis of %q is %s, but previous sources have %s x axis", names[i], source.XAxis, xAxis)
+		}
+
+		if xAxis == "" {
+			xAxis = source.XAxis
+		}
+	}
+
+	var res *FileData
+
+	switch f.kind {
+	case ConcatMerge:
+		res = concatData(sources)
+	case JoinMerge:
+		res = joinData(sources, names)
+	default:
+		res = meanData(sources)
+	}
+
+	res.XAxis = xAxis
+	return res, nil
+}
+
+// concatData - returns points of all sources, series are matched by name
+func concatData(sources []*FileData) *FileData {
+	names, indexes := seriesNames(sources)
+	res := mergedData(sources, names)
+
+	for _, source := range sources {
+		offset := res.Len()
+		res.X = append(res.X, source.X...)
+
+		for _, series := range res.Series {
+			series.Values = append(series.Values, nanValues(source.Len())...)
+		}
+
+		for _, series := range source.Series {
+			copy(res.Series[indexes[series.Name]].Values[offset:], series.Values)
+		}
+	}
+
+	return res
+}
+
+// joinData - returns points at every x of sources with series of all sources
+func joinData(sources []*FileData, sourceNames []string) *FileData {
+	names := make([]string, 0)
+	for i, source := range sources {
+		for _, series := range source.Series {
+			names = append(names, sourceNames[i]+"/"+series.Name)
+		}
+	}
+
+	res := mergedData(sources, names)
+	res.X = unionX(sources)
+
+	s := 0
+	for _, source := range sources {
+		positions := xPositions(res.X, source)
+
+		for _, series := range source.Series {
+			values := nanValues(res.Len())
+			for i, pos := range positions {
+				values[pos] = series.Values[i]
+			}
+
+			res.Series[s].Values = values
+			s++
+		}
+	}
+
+	return res
+}
+
+// meanData - returns mean values of series with the same name at every x of sources
+func meanData(sources []*FileData) *FileData {
+	names, indexes := seriesNames(sources)
+	res := mergedData(sources, names)
+	res.X = unionX(sources)
+
+	counts := make([][]int, len(names))
+	for s := range res.Series {
+		res.Series[s].Values = make(SeriesValues, res.Len())
+		counts[s] = make([]int, res.Len())
+	}
+
+	for _, source := range sources {
+		positions := xPositions(res.X, source)
+
+		for _, series := range source.Series {
+			s := indexes[series.Name]
+
+			for i, pos := range positions {
+				if y := series.Values[i]; !math.IsNaN(y) {
+					res.Series[s].Values[pos] += y
+					counts[s][pos]++
+				}
+			}
+		}
+	}
+
+	for s, series := range res.Series {
+		for i, count := range counts[s] {
+			if count == 0 {
+				series.Values[i] = math.NaN()
+			} else {
+				series.Values[i] /= float64(count)
+			}
+		}
+	}
+
+	return res
+}
+
+// mergedData - returns file data without points with columns of the first source x and series names
+func mergedData(sources []*FileData, names []string) *FileData {
+	xName := "x"
+	if len(sources) != 0 && len(sources[0].Columns) != 0 {
+		xName = sources[0].Columns[0]
+	}
+
+	res := NewFileData(append([]string{xName}, names...))
+	for _, name := range names {
+		res.Series = append(res.Series, &Series{Name: name, Values: make(SeriesValues, 0)})
+	}
+
+	return res
+}
+
+// seriesNames - returns unique series names of sources in order of their appearance with their indexes
+func seriesNames(sources []*FileData) ([]string, map[string]int) {
+	names := make([]string, 0)
+	indexes := make(map[string]int)
+
+	for _, source := range sources {
+		for _, series := range source.Series {
+			if _, ok := indexes[series.Name]; !ok {
+				indexes[series.Name] = len(names)
+				names = append(names, series.Name)
+			}
+		}
+	}
+
+	return names, indexes
+}
+
+// unionX - returns sorted unique x values of all sources
+func unionX(sources []*FileData) []float64 {
+	x := make([]float64, 0)
+	for _, source := range sources {
+		x = append(x, source.X...)
+	}
+
+	sort.Float64s(x)
+
+	unique := x[:0]
+	for _, v := range x {
+		if len(unique) == 0 || v != unique[len(unique)-1] {
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
+}
+
+// xPositions - returns positions of source x values in sorted unique x,
+// points with the same x are mapped to the same position, so the last of them wins
+func xPositions(x []float64, source *FileData) []int {
+	positions := make([]int, 0, source.Len())
+	for _, v := range source.X {
+		positions = append(positions, sort.SearchFloat64s(x, v))
+	}
+
+	return positions
+}
@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/lillilli/graphex/config"
+)
+
+func TestMergedFileCompute(t *testing.T) {
+	a := newTestData([]string{"step", "loss"}, []float64{1, 2, 3}, SeriesValues{1, 2, 3})
+	b := newTestData([]string{"t", "loss", "acc"}, []float64{2, 3, 4}, SeriesValues{10, nan, 30}, SeriesValues{0.1, 0.2, 0.3})
+	duplicated := newTestData([]string{"x", "loss"}, []float64{1, 1, 2}, SeriesValues{1, 5, 2})
+
+	tests := []struct {
+		kind    string
+		sources []*FileData
+		columns []string
+		x       []float64
+		values  [][]float64
+	}{
+		{
+			kind: ConcatMerge, sources: []*FileData{a, b},
+			columns: []string{"step", "loss", "acc"},
+			x:       []float64{1, 2, 3, 2, 3, 4},
+			values:  [][]float64{{1, 2, 3, 10, nan, 30}, {nan, nan, nan, 0.1, 0.2, 0.3}},
+		},
+		{
+			kind: JoinMerge, sources: []*FileData{a, b},
+			columns: []string{"step", "a.csv/loss", "b.csv/loss", "b.csv/acc"},
+			x:       []float64{1, 2, 3, 4},
+			values:  [][]float64{{1, 2, 3, nan}, {nan, 10, nan, 30}, {nan, 0.1, 0.2, 0.3}},
+		},
+		{
+			kind: MeanMerge, sources: []*FileData{a, b},
+			columns: []string{"step", "loss", "acc"},
+			x:       []float64{1, 2, 3, 4},
+			values:  [][]float64{{1, 6, 3, 30}, {nan, 0.1, 0.2, 0.3}},
+		},
+		{
+			kind: JoinMerge, sources: []*FileData{duplicated, b},
+			columns: []string{"x", "a.csv/loss", "b.csv/loss", "b.csv/acc"},
+			x:       []float64{1, 2, 3, 4},
+			values:  [][]float64{{5, 2, nan, nan}, {nan, 10, nan, 30}, {nan, 0.1, 0.2, 0.3}},
+		},
+		{
+			kind: ConcatMerge, sources: []*FileData{newTestData([]string{"x"}, []float64{}), a},
+			columns: []string{"x", "loss"},
+			x:       []float64{1, 2, 3},
+			values:  [][]float64{{1, 2, 3}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			file, err := newMergedFile(config.MergedFile{Kind: test.kind, Sources: []string{"*.csv"}})
+			if err != nil {
+				t.Fatalf("creating merged file failed: %v", err)
+			}
+
+			data, err := file.Compute(test.sources, []string{"a.csv", "b.csv"})
+			if err != nil {
+				t.Fatalf("merging failed: %v", err)
+			}
+
+			if len(data.Columns) != len(test.columns) || !equalValues(data.X, test.x) || len(data.Series) != len(test.values) {
+				t.Fatalf("expected columns %q and x %v, got %q and %v", test.columns, test.x, data.Columns, data.X)
+			}
+
+			for i, series := range data.Series {
+				if series.Name != test.columns[i+1] || data.Columns[i+1] != test.columns[i+1] {
+					t.Errorf("expected series %q, got %q", test.columns[i+1], series.Name)
+				}
+
+				if !equalValues(series.Values, test.values[i]) {
+					t.Errorf("expected %q values %v, got %v", series.Name, test.values[i], series.Values)
+				}
+			}
+		})
+	}
+}
+
+func TestMergedFileXAxisMismatch(t *testing.T) {
+	a := newTestData([]string{"x", "y"}, []float64{1}, SeriesValues{1})
+	a.XAxis = NumberAxis
+
+	b := newTestData([]string{"x", "y"}, []float64{1}, SeriesValues{1})
+	b.XAxis = TimeAxis
+
+	file, err := newMergedFile(config.MergedFile{Sources: []string{"a.csv", "b.csv"}})
+	if err != nil {
+		t.Fatalf("creating merged file failed: %v", err)
+	}
+
+	if _, err := file.Compute([]*FileData{a, b}, []string{"a.csv", "b.csv"}); err == nil {
+		t.Fatal("expected x axis error")
+	}
+}
+
+func TestNewMergedFileErrors(t *testing.T) {
+	tests := []config.MergedFile{
+		{Kind: "sum", Sources: []string{"a.csv"}},
+		{Kind: ConcatMerge},
+		{Kind: MeanMerge, Sources: []string{"[a"}},
+	}
+
+	for _, cfg := range tests {
+		if _, err := newMergedFile(cfg); err == nil {
+			t.Errorf("%+v: expected error", cfg)
+		}
+	}
+}
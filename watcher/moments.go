@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"math"
+)
+
+// moments - count, sum, mean and sum of squared deviations of values, which are added and removed one by one,
+// mean and deviations are updated by Welford's algorithm, so variance of large values is not lost by cancellation
+type moments struct {
+	count float64
+	sum   float64
+	mean  float64
+	m2    float64
+}
+
+func (m *moments) add(v float64) {
+	m.count++
+	m.sum += v
+
+	delta := v - m.mean
+	m.mean += delta / m.count
+	m.m2 += delta * (v - m.mean)
+}
+
+// remove - removes previously added value
+func (m *moments) remove(v float64) {
+	if m.count <= 1 {
+		*m = moments{}
+		return
+	}
+
+	m.count--
+	m.sum -= v
+
+	delta := v - m.mean
+	m.mean -= delta / m.count
+	m.m2 = math.Max(m.m2-delta*(v-m.mean), 0)
+}
+
+// std - returns population standard deviation, it is NaN, if there are no values
+func (m *moments) std() float64 {
+	return math.Sqrt(m.m2 / m.count)
+}
+
+// finite - checks, that value is not NaN or infinity
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
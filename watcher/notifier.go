@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FSNotifyBackend - backend, based on os file system notifications
+	FSNotifyBackend = "fsnotify"
+
+	// PollBackend - backend, based on periodical stat of watched dirs
+	PollBackend = "poll"
+
+	// AutoBackend - poll backend is used for network file systems or if fsnotify is not available
+	AutoBackend = "auto"
+)
+
+// notifier - file system notifications backend, dirs are watched non-recursively
+type notifier interface {
+	Add(path string) error
+	Remove(path string) error
+
+	Events() <-chan fsnotify.Event
+	Errors() <-chan error
+
+	Close() error
+}
+
+// fsNotifier - notifier, based on fsnotify
+type fsNotifier struct {
+	*fsnotify.Watcher
+}
+
+func (n *fsNotifier) Events() <-chan fsnotify.Event {
+	return n.Watcher.Events
+}
+
+func (n *fsNotifier) Errors() <-chan error {
+	return n.Watcher.Errors
+}
+
+// newNotifier - returns notifier for the backend
+func (w *watcher) newNotifier() (notifier, error) {
+	switch w.backend {
+	case FSNotifyBackend, "":
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return nil, err
+		}
+
+		return &fsNotifier{watcher}, nil
+
+	case PollBackend:
+		return newPoller(w.pollInterval), nil
+
+	case AutoBackend:
+		if isNetworkFS(w.dir) {
+			w.log.Infof("Dir %q is on network file system, polling is used", w.dir)
+			return newPoller(w.pollInterval), nil
+		}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			w.log.Warnf("Creating fsnotify watcher failed, polling is used: %v", err)
+			return newPoller(w.pollInterval), nil
+		}
+
+		return &fsNotifier{watcher}, nil
+	}
+
+	return nil, errors.Errorf("unknown watcher backend %q", w.backend)
+}
@@ -1,41 +1,348 @@
 package watcher
 
 import (
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+
+	"github.com/lillilli/graphex/config"
 )
 
+// MaxDiagnostics - max count of diagnostics, which are kept for one parsed file part
+const MaxDiagnostics = 1000
+
+// maxDiagnosticRawSize - max length of the line text, kept in diagnostic
+const maxDiagnosticRawSize = 256
+
+// FileData - parsed data file content: one x vector and N named y series,
+// rows, which could not be parsed, are reported as warnings (only first MaxDiagnostics are kept)
 type FileData struct {
-	Values [][2]float64 `json:"values"`
+	Columns []string  `json:"columns,omitempty"`
+	X       []float64 `json:"x"`
+	Series  []*Series `json:"series"`
+
+	// XAxis - type of x values: number or time (epoch milliseconds), it is empty, if there are no points
+	XAxis string `json:"x_axis,omitempty"`
+
+	Warnings      []*Diagnostic `json:"-"`
+	WarningsCount int           `json:"-"`
+
+	// Version - monotonically increasing version of the file data, set by watcher
+	Version uint64 `json:"-"`
+
+	xParser *XParser
+}
+
+// Diagnostic - parsing problem of the file line
+type Diagnostic struct {
+	Line   int    `json:"line"`
+	Raw    string `json:"raw"`
+	Reason string `json:"reason"`
+}
+
+// Series - named y series, missing values are NaN
+type Series struct {
+	Name   string       `json:"name"`
+	Values SeriesValues `json:"values"`
 }
 
-func parseFile(b []byte) *FileData {
-	stringifiedFile := string(b)
-	res := &FileData{Values: make([][2]float64, 0)}
-	rows := strings.Split(stringifiedFile, "\r\n")
+// SeriesValues - series values, NaN values are encoded as json null
+type SeriesValues []float64
 
-	for i, row := range rows {
-		if i == 0 || strings.TrimSpace(row) == "" {
-			continue
+// Parser - data file parser interface
+type Parser interface {
+	Parse(b []byte) (*FileData, error)
+}
+
+// TailParser - parser, which is able to parse complete lines, appended to the already parsed file,
+// columns are taken from the previously parsed file header, line is the number of the first line of b
+type TailParser interface {
+	Parser
+	ParseTail(b []byte, columns []string, line int) (*FileData, error)
+}
+
+// ParserFunc - adapter, which allows to use ordinary functions as parsers
+type ParserFunc func(b []byte) (*FileData, error)
+
+// Parse - calls f(b)
+func (f ParserFunc) Parse(b []byte) (*FileData, error) {
+	return f(b)
+}
+
+// NewFileData - returns empty file data with columns, first column is x
+func NewFileData(columns []string) *FileData {
+	return &FileData{Columns: columns, X: make([]float64, 0), Series: make([]*Series, 0)}
+}
+
+// WithXParser - sets parser of x values for the appended rows, DefaultXParser is used, if it is not set
+func (d *FileData) WithXParser(p *XParser) *FileData {
+	d.xParser = p
+	return d
+}
+
+// Len - returns points count
+func (d *FileData) Len() int {
+	return len(d.X)
+}
+
+// Size - returns approximate memory size of the data in bytes
+func (d *FileData) Size() int64 {
+	size := int64(len(d.X)) * 8 * int64(len(d.Series)+1)
+
+	for _, warning := range d.Warnings {
+		size += int64(len(warning.Raw) + len(warning.Reason) + 32)
+	}
+
+	return size
+}
+
+// Merge - returns new file data with appended points of tail, d stays valid and could be read during the merge,
+// but it shares arrays with the result, so only the result could be merged further
+func (d *FileData) Merge(tail *FileData) *FileData {
+	res := &FileData{
+		Columns:       d.Columns,
+		X:             append(d.X, tail.X...),
+		Series:        make([]*Series, 0, len(d.Series)),
+		XAxis:         d.XAxis,
+		Warnings:      d.Warnings,
+		WarningsCount: d.WarningsCount + tail.WarningsCount,
+		Version:       tail.Version,
+	}
+
+	for i := 0; i < len(d.Series) || i < len(tail.Series); i++ {
+		var values SeriesValues
+
+		switch {
+		case i < len(d.Series):
+			res.Series = append(res.Series, &Series{Name: d.Series[i].Name})
+			values = d.Series[i].Values
+		default:
+			res.Series = append(res.Series, &Series{Name: tail.Series[i].Name})
+			values = nanValues(len(d.X))
+		}
+
+		if i < len(tail.Series) {
+			values = append(values, tail.Series[i].Values...)
+		} else {
+			values = append(values, nanValues(len(tail.X))...)
+		}
+
+		res.Series[i].Values = values
+	}
+
+	if res.XAxis == "" {
+		res.XAxis = tail.XAxis
+	}
+
+	for _, warning := range tail.Warnings {
+		if len(res.Warnings) >= MaxDiagnostics {
+			break
 		}
 
-		values := strings.Split(row, " ")
-		if len(values) < 2 {
+		res.Warnings = append(res.Warnings, warning)
+	}
+
+	return res
+}
+
+// Points - returns [x, y] pairs of the first series, rows without y are skipped
+func (d *FileData) Points() [][2]float64 {
+	points := make([][2]float64, 0, len(d.X))
+	if len(d.Series) == 0 {
+		return points
+	}
+
+	for i, x := range d.X {
+		y := d.Series[0].Values[i]
+		if math.IsNaN(y) {
 			continue
 		}
 
-		x, err := strconv.ParseFloat(values[0], 64)
+		points = append(points, [2]float64{x, y})
+	}
+
+	return points
+}
+
+// AppendRow - parses row fields (x first) and appends them, raw is the line text,
+// row is skipped, if x could not be parsed, its type differs from the previous rows one or all of y values are not numbers,
+// problems are reported as warnings
+func (d *FileData) AppendRow(line int, raw string, fields []string) bool {
+	if len(fields) < 2 {
+		d.Warn(line, raw, "not enough fields")
+		return false
+	}
+
+	xParser := d.xParser
+	if xParser == nil {
+		xParser = DefaultXParser
+	}
+
+	x, axis, err := xParser.Parse(fields[0])
+	if err != nil {
+		d.Warn(line, raw, fmt.Sprintf("bad x value %q", fields[0]))
+		return false
+	}
+
+	if d.XAxis != "" && axis != d.XAxis {
+		d.Warn(line, raw, fmt.Sprintf("x value %q is not a %s", fields[0], d.XAxis))
+		return false
+	}
+
+	ys := make([]float64, len(fields)-1)
+	badFields := make([]int, 0)
+
+	for i, field := range fields[1:] {
+		y, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
 		if err != nil {
+			y = math.NaN()
+			badFields = append(badFields, i+1)
+		}
+
+		ys[i] = y
+	}
+
+	if len(badFields) == len(ys) {
+		d.Warn(line, raw, "no numeric y values")
+		return false
+	}
+
+	for _, i := range badFields {
+		d.Warn(line, raw, fmt.Sprintf("bad y value %q in column %d", fields[i], i+1))
+	}
+
+	for len(d.Series) < len(ys) {
+		d.addSeries()
+	}
+
+	for i, series := range d.Series {
+		y := math.NaN()
+		if i < len(ys) {
+			y = ys[i]
+		}
+
+		series.Values = append(series.Values, y)
+	}
+
+	d.X = append(d.X, x)
+	d.XAxis = axis
+	return true
+}
+
+// Warn - reports parsing problem of the line
+func (d *FileData) Warn(line int, raw, reason string) {
+	d.WarningsCount++
+
+	if len(d.Warnings) >= MaxDiagnostics {
+		return
+	}
+
+	if len(raw) > maxDiagnosticRawSize {
+		raw = raw[:maxDiagnosticRawSize]
+	}
+
+	d.Warnings = append(d.Warnings, &Diagnostic{Line: line, Raw: raw, Reason: reason})
+}
+
+// LimitWarnings - keeps only first limit warnings, total warnings count is not changed
+func (d *FileData) LimitWarnings(limit int) {
+	if limit >= 0 && len(d.Warnings) > limit {
+		d.Warnings = d.Warnings[:limit]
+	}
+}
+
+// addSeries - adds series, named by column header, previous rows are filled with NaN
+func (d *FileData) addSeries() {
+	index := len(d.Series) + 1
+	name := fmt.Sprintf("y%d", index)
+
+	if index < len(d.Columns) && d.Columns[index] != "" {
+		name = d.Columns[index]
+	}
+
+	d.Series = append(d.Series, &Series{Name: name, Values: nanValues(len(d.X))})
+}
+
+func nanValues(n int) SeriesValues {
+	values := make(SeriesValues, n)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+
+	return values
+}
+
+// MarshalJSON - encodes values as json array, NaN values are encoded as null
+func (v SeriesValues) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, len(v)*8+2)
+	b = append(b, '[')
+
+	for i, value := range v {
+		if i > 0 {
+			b = append(b, ',')
+		}
+
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			b = append(b, "null"...)
 			continue
 		}
 
-		y, err := strconv.ParseFloat(values[1], 64)
-		if err != nil {
+		b = strconv.AppendFloat(b, value, 'g', -1, 64)
+	}
+
+	return append(b, ']'), nil
+}
+
+// textParser - parser for space separated files, first line is a header
+type textParser struct {
+	x *XParser
+}
+
+// NewTextParser - returns new space separated files parser
+func NewTextParser(cfg config.XAxis) (Parser, error) {
+	x, err := NewXParser(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &textParser{x: x}, nil
+}
+
+func (p *textParser) Parse(b []byte) (*FileData, error) {
+	return p.parse(b, nil, 1, true), nil
+}
+
+func (p *textParser) ParseTail(b []byte, columns []string, line int) (*FileData, error) {
+	return p.parse(b, columns, line, false), nil
+}
+
+func (p *textParser) parse(b []byte, columns []string, line int, withHeader bool) *FileData {
+	res := NewFileData(columns).WithXParser(p.x)
+
+	for i, row := range splitLines(b) {
+		if strings.TrimSpace(row) == "" {
 			continue
 		}
 
-		res.Values = append(res.Values, [2]float64{x, y})
+		if i == 0 && withHeader {
+			res.Columns = strings.Fields(row)
+			continue
+		}
+
+		res.AppendRow(line+i, row, strings.Split(row, " "))
 	}
 
 	return res
 }
+
+// splitLines - splits content into lines, both "\n" and "\r\n" line endings are supported
+func splitLines(b []byte) []string {
+	lines := strings.Split(string(b), "\n")
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines
+}
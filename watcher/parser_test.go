@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"math"
+	"testing"
+)
+
+var nan = math.NaN()
+
+// newTestData - returns file data of the columns, first column is x, series values follow the rest columns
+func newTestData(columns []string, x []float64, values ...SeriesValues) *FileData {
+	data := &FileData{Columns: columns, X: x, Series: make([]*Series, 0, len(values))}
+
+	for i, v := range values {
+		data.Series = append(data.Series, &Series{Name: columns[i+1], Values: v})
+	}
+
+	return data
+}
+
+// equalValues - compares values with tolerance, NaN values are equal
+func equalValues(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if math.IsNaN(a[i]) != math.IsNaN(b[i]) {
+			return false
+		}
+
+		if !math.IsNaN(a[i]) && a[i] != b[i] && math.Abs(a[i]-b[i]) > 1e-9*math.Max(1, math.Abs(b[i])) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestFileDataMerge(t *testing.T) {
+	data := newTestData([]string{"x", "a"}, []float64{1, 2}, SeriesValues{1, 2})
+	data.Version = 1
+
+	tail := newTestData([]string{"x", "a", "b"}, []float64{3}, SeriesValues{3}, SeriesValues{30})
+	tail.Version = 2
+
+	merged := data.Merge(tail)
+
+	if merged.Version != 2 || !equalValues(merged.X, []float64{1, 2, 3}) || len(merged.Series) != 2 {
+		t.Fatalf("unexpected merged data: version %d, x %v, %d series", merged.Version, merged.X, len(merged.Series))
+	}
+
+	if !equalValues(merged.Series[0].Values, []float64{1, 2, 3}) {
+		t.Errorf("unexpected values of %q: %v", merged.Series[0].Name, merged.Series[0].Values)
+	}
+
+	if merged.Series[1].Name != "b" || !equalValues(merged.Series[1].Values, []float64{nan, nan, 30}) {
+		t.Errorf("unexpected values of %q: %v", merged.Series[1].Name, merged.Series[1].Values)
+	}
+
+	if data.Len() != 2 || len(data.Series[0].Values) != 2 {
+		t.Errorf("merged data is changed: %v", data.X)
+	}
+}
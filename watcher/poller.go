@@ -0,0 +1,181 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// poller - notifier, which periodically stats entries of watched dirs,
+// it is used on file systems, where os notifications are not delivered (nfs, smb, some docker mounts)
+type poller struct {
+	interval time.Duration
+
+	dirs   map[string]map[string]os.FileInfo
+	events chan fsnotify.Event
+	errors chan error
+
+	done chan struct{}
+	sync.Mutex
+}
+
+func newPoller(interval time.Duration) *poller {
+	p := &poller{
+		interval: interval,
+		dirs:     make(map[string]map[string]os.FileInfo),
+		events:   make(chan fsnotify.Event),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+	}
+
+	go p.run()
+	return p
+}
+
+// Add - starts dir polling, current dir entries are not reported
+func (p *poller) Add(path string) error {
+	entries, err := readEntries(path)
+	if err != nil {
+		return err
+	}
+
+	p.Lock()
+	p.dirs[filepath.Clean(path)] = entries
+	p.Unlock()
+	return nil
+}
+
+// Remove - stops dir polling
+func (p *poller) Remove(path string) error {
+	p.Lock()
+	delete(p.dirs, filepath.Clean(path))
+	p.Unlock()
+	return nil
+}
+
+func (p *poller) Events() <-chan fsnotify.Event {
+	return p.events
+}
+
+func (p *poller) Errors() <-chan error {
+	return p.errors
+}
+
+func (p *poller) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+
+	return nil
+}
+
+func (p *poller) run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, event := range p.poll() {
+				select {
+				case p.events <- event:
+				case <-p.done:
+					return
+				}
+			}
+
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// poll - compares current entries of watched dirs with the previous ones and returns changes
+func (p *poller) poll() []fsnotify.Event {
+	p.Lock()
+	dirs := make([]string, 0, len(p.dirs))
+
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+
+	p.Unlock()
+
+	events := make([]fsnotify.Event, 0)
+
+	for _, dir := range dirs {
+		// dir removal is reported by the parent dir
+		entries, err := readEntries(dir)
+		if err != nil {
+			continue
+		}
+
+		p.Lock()
+		previous, ok := p.dirs[dir]
+		if ok {
+			p.dirs[dir] = entries
+		}
+		p.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		events = append(events, diffEntries(dir, previous, entries)...)
+	}
+
+	return events
+}
+
+func diffEntries(dir string, previous, current map[string]os.FileInfo) []fsnotify.Event {
+	events := make([]fsnotify.Event, 0)
+
+	for name, info := range current {
+		fullPath := filepath.Join(dir, name)
+		previousInfo, ok := previous[name]
+
+		switch {
+		case !ok:
+			events = append(events, fsnotify.Event{Name: fullPath, Op: fsnotify.Create})
+		case info.IsDir() != previousInfo.IsDir():
+			events = append(events, fsnotify.Event{Name: fullPath, Op: fsnotify.Remove})
+			events = append(events, fsnotify.Event{Name: fullPath, Op: fsnotify.Create})
+		case info.IsDir():
+		case info.Size() != previousInfo.Size() || !info.ModTime().Equal(previousInfo.ModTime()):
+			events = append(events, fsnotify.Event{Name: fullPath, Op: fsnotify.Write})
+		case info.Mode() != previousInfo.Mode():
+			events = append(events, fsnotify.Event{Name: fullPath, Op: fsnotify.Chmod})
+		}
+	}
+
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+		}
+	}
+
+	return events
+}
+
+func readEntries(dir string) (map[string]os.FileInfo, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]os.FileInfo, len(fileInfos))
+	for _, fileInfo := range fileInfos {
+		entries[fileInfo.Name()] = fileInfo
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,316 @@
+package watcher
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	// pyramidFactor - count of buckets of the previous level, aggregated by one bucket of the next level
+	pyramidFactor = 4
+
+	// minPyramidPoints - min points count of the file, for which pyramid is built,
+	// smaller files are queried directly
+	minPyramidPoints = 4096
+
+	// minPyramidBuckets - coarsest level of the pyramid has not more buckets
+	minPyramidBuckets = 64
+)
+
+// RangeData - file points in x range with their level of detail:
+// pyramid levels (from 1) contain min and max values of every bucket of BucketSize raw points
+// (min value is placed at the first x of the bucket and max value at the last one),
+// level 0 contains raw points, which are reduced by min/max downsampling, if there are too many of them
+// (bucket size is 1 for not reduced points)
+type RangeData struct {
+	From       float64
+	To         float64
+	Level      int
+	BucketSize int
+	*FileData
+}
+
+// pyramid - multi resolution min/max levels of the file data with sorted x,
+// it is extended by appended points, so it is built only once for the file version
+type pyramid struct {
+	version uint64
+	points  int
+	series  int
+	levels  []*pyramidLevel
+	sync.RWMutex
+}
+
+// pyramidLevel - buckets of size raw points
+type pyramidLevel struct {
+	size   int
+	xFirst []float64
+	xLast  []float64
+	min    [][]float64
+	max    [][]float64
+}
+
+// newPyramid - returns pyramid of the file data, returns false, if x values are not sorted
+func newPyramid(data *FileData) (*pyramid, bool) {
+	if !sortedX(data.X, math.Inf(-1)) {
+		return nil, false
+	}
+
+	p := &pyramid{version: data.Version, series: len(data.Series)}
+
+	for size, buckets := pyramidFactor, data.Len(); ; size *= pyramidFactor {
+		p.levels = append(p.levels, &pyramidLevel{size: size})
+
+		if buckets /= pyramidFactor; buckets <= minPyramidBuckets {
+			break
+		}
+	}
+
+	p.add(data)
+	return p, true
+}
+
+// extend - adds appended points to the pyramid, returns false, if pyramid should be rebuilt
+func (p *pyramid) extend(tail *FileData, version uint64) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if len(tail.Series) > p.series || !sortedX(tail.X, p.lastX()) {
+		return false
+	}
+
+	p.add(tail)
+	p.version = version
+	return true
+}
+
+func (p *pyramid) lastX() float64 {
+	level := p.levels[0]
+	if len(level.xLast) == 0 {
+		return math.Inf(-1)
+	}
+
+	return level.xLast[len(level.xLast)-1]
+}
+
+// add - adds every point to the bucket of every level
+func (p *pyramid) add(data *FileData) {
+	for i, x := range data.X {
+		index := p.points + i
+
+		for _, level := range p.levels {
+			b := index / level.size
+
+			if b == len(level.xFirst) {
+				level.xFirst = append(level.xFirst, x)
+				level.xLast = append(level.xLast, x)
+
+				for s := 0; s < p.series; s++ {
+					if s == len(level.min) {
+						level.min = append(level.min, make([]float64, 0))
+						level.max = append(level.max, make([]float64, 0))
+					}
+
+					level.min[s] = append(level.min[s], math.NaN())
+					level.max[s] = append(level.max[s], math.NaN())
+				}
+			}
+
+			level.xLast[b] = x
+
+			for s, series := range data.Series {
+				y := series.Values[i]
+				if math.IsNaN(y) {
+					continue
+				}
+
+				if lo := level.min[s][b]; math.IsNaN(lo) || y < lo {
+					level.min[s][b] = y
+				}
+
+				if hi := level.max[s][b]; math.IsNaN(hi) || y > hi {
+					level.max[s][b] = y
+				}
+			}
+		}
+	}
+
+	p.points += data.Len()
+}
+
+// query - returns points of raw index range [start, end) from the finest level, which has not more than width buckets,
+// returns false, if range should be served from raw points (also, if the data does not fit the pyramid)
+func (p *pyramid) query(data *FileData, start, end, width int) (*RangeData, bool) {
+	p.RLock()
+	defer p.RUnlock()
+
+	if end-start <= 2*width || p.version != data.Version {
+		return nil, false
+	}
+
+	if end > p.points || len(data.Series) > p.series {
+		return nil, false
+	}
+
+	level, levelIndex := p.levels[len(p.levels)-1], len(p.levels)
+	for i, l := range p.levels {
+		if (end-start+l.size-1)/l.size <= width {
+			level, levelIndex = l, i+1
+			break
+		}
+	}
+
+	first, last := start/level.size, (end-1)/level.size
+	res := &FileData{
+		Columns: data.Columns,
+		X:       make([]float64, 0, 2*(last-first+1)),
+		Series:  make([]*Series, 0, len(data.Series)),
+		XAxis:   data.XAxis,
+		Version: data.Version,
+	}
+
+	for b := first; b <= last; b++ {
+		res.X = append(res.X, level.xFirst[b], level.xLast[b])
+	}
+
+	for s, series := range data.Series {
+		values := make(SeriesValues, 0, len(res.X))
+		for b := first; b <= last; b++ {
+			values = append(values, level.min[s][b], level.max[s][b])
+		}
+
+		res.Series = append(res.Series, &Series{Name: series.Name, Values: values})
+	}
+
+	return &RangeData{Level: levelIndex, BucketSize: level.size, FileData: res}, true
+}
+
+// rangeQuery - returns points of the file data in x range, reduced to about 2 * width points,
+// pyramid is used, if it is set, otherwise raw points are reduced
+func rangeQuery(data *FileData, p *pyramid, from, to float64, width int) *RangeData {
+	if width < 1 {
+		width = 1
+	}
+
+	var points *FileData
+
+	if sortedX(data.X, math.Inf(-1)) {
+		start := sort.SearchFloat64s(data.X, from)
+		end := sort.Search(len(data.X), func(i int) bool { return data.X[i] > to })
+
+		if p != nil {
+			if res, ok := p.query(data, start, end, width); ok {
+				res.From, res.To = from, to
+				return res
+			}
+		}
+
+		points = data.slice(start, end)
+	} else {
+		indexes := make([]int, 0)
+		for i, x := range data.X {
+			if x >= from && x <= to {
+				indexes = append(indexes, i)
+			}
+		}
+
+		points = data.pick(indexes)
+	}
+
+	bucketSize := 1
+	if points.Len() > 2*width {
+		bucketSize = (points.Len() + width - 1) / width
+	}
+
+	return &RangeData{From: from, To: to, BucketSize: bucketSize, FileData: Downsample(points, MinMaxDownsampling, 2*width)}
+}
+
+// sortedX - checks, if x values are sorted and are not less than prev
+func sortedX(x []float64, prev float64) bool {
+	for _, v := range x {
+		if v < prev {
+			return false
+		}
+
+		prev = v
+	}
+
+	return true
+}
+
+// RangeQuery - returns file points in x range [from, to] for the plot of width pixels,
+// points are served from the file pyramid, if it is built, or reduced on the fly otherwise
+func (w *watcher) RangeQuery(name string, from, to float64, width int) (*RangeData, error) {
+	data, err := w.FileState(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rangeQuery(data, w.pyramid(logicalName(name), data), from, to, width), nil
+}
+
+// pyramid - returns pyramid of the file data version, starts building of it, if there is no such pyramid
+func (w *watcher) pyramid(name string, data *FileData) *pyramid {
+	w.RLock()
+	p, ok := w.pyramids[name]
+	w.RUnlock()
+
+	if ok {
+		p.RLock()
+		version := p.version
+		p.RUnlock()
+
+		if version == data.Version {
+			return p
+		}
+	}
+
+	w.buildPyramid(name, data)
+	return nil
+}
+
+// buildPyramid - builds pyramid of the big file data in background, pyramid is dropped, if file was changed meanwhile
+func (w *watcher) buildPyramid(name string, data *FileData) {
+	w.Lock()
+	defer w.Unlock()
+
+	delete(w.pyramids, name)
+
+	if data.Len() < minPyramidPoints || w.building[name] {
+		return
+	}
+
+	w.building[name] = true
+
+	go func() {
+		p, ok := newPyramid(data)
+
+		w.Lock()
+		defer w.Unlock()
+
+		delete(w.building, name)
+
+		if ok && w.versions[name] == data.Version && w.files[name] != "" {
+			w.pyramids[name] = p
+		}
+	}()
+}
+
+// extendPyramid - adds appended points to the file pyramid, which was built for the previous file data version
+func (w *watcher) extendPyramid(name string, tail *FileData, prevVersion uint64) {
+	w.Lock()
+	defer w.Unlock()
+
+	p, ok := w.pyramids[name]
+	if !ok {
+		return
+	}
+
+	p.RLock()
+	actual := p.version == prevVersion
+	p.RUnlock()
+
+	if !actual || !p.extend(tail, tail.Version) {
+		delete(w.pyramids, name)
+	}
+}
@@ -0,0 +1,66 @@
+package watcher
+
+import (
+	"testing"
+)
+
+func pyramidTestData(points, series int, version uint64) *FileData {
+	data := &FileData{X: make([]float64, points), Version: version}
+
+	for s := 0; s < series; s++ {
+		data.Series = append(data.Series, &Series{Name: string(rune('a' + s)), Values: make(SeriesValues, points)})
+	}
+
+	for i := range data.X {
+		data.X[i] = float64(i)
+
+		for s, series := range data.Series {
+			series.Values[i] = float64((i + s) % 17)
+		}
+	}
+
+	return data
+}
+
+func TestRangeQueryPyramid(t *testing.T) {
+	data := pyramidTestData(5000, 1, 1)
+
+	p, ok := newPyramid(data)
+	if !ok {
+		t.Fatal("pyramid is not built")
+	}
+
+	res := rangeQuery(data, p, 0, 6000, 10)
+	if res.Level == 0 || res.Len() == 0 {
+		t.Fatalf("expected pyramid level, got level %d with %d points", res.Level, res.Len())
+	}
+}
+
+func TestRangeQueryPyramidMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		data *FileData
+	}{
+		{name: "more points", data: pyramidTestData(5100, 1, 1)},
+		{name: "more series", data: pyramidTestData(5000, 2, 1)},
+		{name: "other version", data: pyramidTestData(5000, 1, 2)},
+	}
+
+	p, ok := newPyramid(pyramidTestData(5000, 1, 1))
+	if !ok {
+		t.Fatal("pyramid is not built")
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := rangeQuery(test.data, p, 0, 6000, 10)
+			if res.Level != 0 {
+				t.Fatalf("expected raw points, got level %d", res.Level)
+			}
+
+			if res.Len() == 0 || res.Len() > 20 {
+				t.Fatalf("expected up to 20 reduced points, got %d", res.Len())
+			}
+		})
+	}
+}
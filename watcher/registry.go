@@ -0,0 +1,181 @@
+package watcher
+
+import (
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// TextFormat - name of the default space separated format
+const TextFormat = "txt"
+
+// ErrNoParser - returns, when there is no parser for the file
+var ErrNoParser = errors.New("no parser for file")
+
+// DefaultRegistry - registry, which is used by watchers by default
+var DefaultRegistry = NewRegistry()
+
+// Registry - parsers registry,
+// parser for file is chosen by glob patterns first and by file extension then
+type Registry struct {
+	parsers    map[string]Parser
+	extensions map[string]string
+	patterns   []patternBinding
+	sync.RWMutex
+}
+
+type patternBinding struct {
+	pattern string
+	format  string
+}
+
+// NewRegistry - returns new parsers registry with default formats
+func NewRegistry() *Registry {
+	r := &Registry{
+		parsers:    make(map[string]Parser),
+		extensions: make(map[string]string),
+		patterns:   make([]patternBinding, 0),
+	}
+
+	r.Register(TextFormat, &textParser{x: DefaultXParser}, ".txt")
+	r.Register(CSVFormat, &csvParser{delimiter: ',', comment: "#", x: DefaultXParser}, ".csv")
+	r.Register(TSVFormat, &csvParser{delimiter: '\t', comment: "#", x: DefaultXParser}, ".tsv")
+	return r
+}
+
+// RegisterParser - registers parser in the default registry
+func RegisterParser(format string, parser Parser, extensions ...string) {
+	DefaultRegistry.Register(format, parser, extensions...)
+}
+
+// Register - registers parser for format and binds format to file extensions (with leading dot)
+func (r *Registry) Register(format string, parser Parser, extensions ...string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.parsers[format] = parser
+
+	for _, ext := range extensions {
+		r.extensions[strings.ToLower(ext)] = format
+	}
+}
+
+// Bind - binds files, matched by glob pattern, to the registered format,
+// patterns without "/" are matched against the base file name
+func (r *Registry) Bind(pattern, format string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return errors.Wrapf(err, "bad pattern %q", pattern)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.parsers[format]; !ok {
+		return errors.Errorf("unknown format %q", format)
+	}
+
+	r.patterns = append(r.patterns, patternBinding{pattern: pattern, format: format})
+	return nil
+}
+
+// Clone - returns registry copy, so bindings could be added without affecting the original one
+func (r *Registry) Clone() *Registry {
+	r.RLock()
+	defer r.RUnlock()
+
+	clone := &Registry{
+		parsers:    make(map[string]Parser, len(r.parsers)),
+		extensions: make(map[string]string, len(r.extensions)),
+		patterns:   append(make([]patternBinding, 0, len(r.patterns)), r.patterns...),
+	}
+
+	for format, parser := range r.parsers {
+		clone.parsers[format] = parser
+	}
+
+	for ext, format := range r.extensions {
+		clone.extensions[ext] = format
+	}
+
+	return clone
+}
+
+// newRootRegistry - returns copy of the default registry with parsers, configured for the root
+func newRootRegistry(root config.Root, cfg config.Watcher) (*Registry, error) {
+	parsers := DefaultRegistry.Clone()
+
+	csvConfig, tsvConfig, xAxis := cfg.CSV, cfg.TSV, cfg.XAxis
+	if root.CSV != nil {
+		csvConfig = *root.CSV
+	}
+
+	if root.TSV != nil {
+		tsvConfig = *root.TSV
+	}
+
+	if root.XAxis != nil {
+		xAxis = *root.XAxis
+	}
+
+	textParser, err := NewTextParser(xAxis)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating txt parser failed")
+	}
+
+	csvParser, err := NewCSVParser(csvConfig, xAxis)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating csv parser failed")
+	}
+
+	tsvParser, err := NewTSVParser(tsvConfig, xAxis)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating tsv parser failed")
+	}
+
+	parsers.Register(TextFormat, textParser)
+	parsers.Register(CSVFormat, csvParser)
+	parsers.Register(TSVFormat, tsvParser)
+
+	for _, rule := range append(append([]config.ParserRule{}, root.Parsers...), cfg.Parsers...) {
+		if err := parsers.Bind(rule.Pattern, rule.Format); err != nil {
+			return nil, errors.Wrap(err, "binding parser failed")
+		}
+	}
+
+	return parsers, nil
+}
+
+// Lookup - returns parser and its format for slash separated file name,
+// compressed files are looked up by the name without compression extension
+func (r *Registry) Lookup(name string) (Parser, string, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	name = logicalName(name)
+
+	for _, binding := range r.patterns {
+		if matchPattern(binding.pattern, name) {
+			return r.parsers[binding.format], binding.format, true
+		}
+	}
+
+	format, ok := r.extensions[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return nil, "", false
+	}
+
+	return r.parsers[format], format, true
+}
+
+func matchPattern(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
@@ -0,0 +1,196 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// RootSeparator - separates root name and file path in file name of multi roots watcher
+const RootSeparator = ":"
+
+// ErrUnknownRoot - returns, when file name points to not configured root
+var ErrUnknownRoot = errors.New("unknown watch root")
+
+// rootsWatcher - watcher of several named roots,
+// files are named "root:path", if there are several roots, and just "path" otherwise
+type rootsWatcher struct {
+	names    []string
+	watchers map[string]Watcher
+	events   chan *Event
+}
+
+// NewRoots - returns watcher of all of the roots, cache budget is shared between roots
+func NewRoots(roots []config.Root, cfg config.Watcher) (Watcher, error) {
+	if len(roots) == 0 {
+		return nil, errors.New("no watch roots")
+	}
+
+	w := &rootsWatcher{
+		names:    make([]string, 0, len(roots)),
+		watchers: make(map[string]Watcher, len(roots)),
+		events:   make(chan *Event),
+	}
+
+	cfg.CacheBudget /= int64(len(roots))
+
+	for _, root := range roots {
+		if root.Name == "" || strings.Contains(root.Name, RootSeparator) {
+			return nil, errors.Errorf("bad root name %q", root.Name)
+		}
+
+		if _, ok := w.watchers[root.Name]; ok {
+			return nil, errors.Errorf("duplicated root name %q", root.Name)
+		}
+
+		watcher, err := New(root, cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating watcher for root %q failed", root.Name)
+		}
+
+		w.names = append(w.names, root.Name)
+		w.watchers[root.Name] = watcher
+	}
+
+	return w, nil
+}
+
+func (w *rootsWatcher) Start(ctx context.Context) error {
+	for _, name := range w.names {
+		watcher := w.watchers[name]
+
+		if err := watcher.Start(ctx); err != nil {
+			return errors.Wrapf(err, "starting watcher for root %q failed", name)
+		}
+
+		go w.forwardEvents(ctx, name, watcher)
+	}
+
+	return nil
+}
+
+// forwardEvents - sends root watcher events with full file names
+func (w *rootsWatcher) forwardEvents(ctx context.Context, root string, watcher Watcher) {
+	updates := watcher.UpdatesChannel()
+
+	for {
+		select {
+		case event := <-updates:
+			w.events <- &Event{Type: event.Type, Name: w.fullName(root, event.Name), Values: event.Values}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *rootsWatcher) UpdatesChannel() <-chan *Event {
+	return w.events
+}
+
+// State - returns full names of files of all roots
+func (w *rootsWatcher) State() []string {
+	files := make([]string, 0)
+
+	for _, root := range w.Roots() {
+		for _, fileName := range root.Files {
+			files = append(files, w.fullName(root.Name, fileName))
+		}
+	}
+
+	return files
+}
+
+// Roots - returns roots with their files, file names are relative to the root
+func (w *rootsWatcher) Roots() []RootState {
+	roots := make([]RootState, 0, len(w.names))
+
+	for _, name := range w.names {
+		roots = append(roots, w.watchers[name].Roots()...)
+	}
+
+	return roots
+}
+
+// Listing - returns roots with their files metadata, file names are relative to the root
+func (w *rootsWatcher) Listing() []RootListing {
+	roots := make([]RootListing, 0, len(w.names))
+
+	for _, name := range w.names {
+		roots = append(roots, w.watchers[name].Listing()...)
+	}
+
+	return roots
+}
+
+func (w *rootsWatcher) FileState(name string) (*FileData, error) {
+	watcher, fileName, err := w.split(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return watcher.FileState(fileName)
+}
+
+func (w *rootsWatcher) RangeQuery(name string, from, to float64, width int) (*RangeData, error) {
+	watcher, fileName, err := w.split(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return watcher.RangeQuery(fileName, from, to, width)
+}
+
+// Health - returns the worst health state of roots, restarts are summed up
+func (w *rootsWatcher) Health() Health {
+	var res Health
+
+	for i, name := range w.names {
+		health := w.watchers[name].Health()
+		restarts := res.Restarts + health.Restarts
+
+		if i == 0 || res.Status == HealthOK && health.Status != HealthOK {
+			res = health
+
+			if health.LastError != "" {
+				res.LastError = fmt.Sprintf("%s: %s", name, health.LastError)
+			}
+		}
+
+		res.Restarts = restarts
+	}
+
+	return res
+}
+
+// fullName - returns file name, which is unique between roots
+func (w *rootsWatcher) fullName(root, fileName string) string {
+	if len(w.names) == 1 {
+		return fileName
+	}
+
+	return root + RootSeparator + fileName
+}
+
+// split - returns root watcher and file name relative to the root
+func (w *rootsWatcher) split(name string) (Watcher, string, error) {
+	if len(w.names) == 1 {
+		return w.watchers[w.names[0]], name, nil
+	}
+
+	parts := strings.SplitN(name, RootSeparator, 2)
+	if len(parts) != 2 {
+		return nil, "", ErrUnknownRoot
+	}
+
+	watcher, ok := w.watchers[parts[0]]
+	if !ok {
+		return nil, "", ErrUnknownRoot
+	}
+
+	return watcher, parts[1], nil
+}
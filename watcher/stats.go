@@ -0,0 +1,411 @@
+package watcher
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHistogramBins - histogram bins count, if it is not set
+	DefaultHistogramBins = 20
+
+	// maxHistogramBins - max histogram bins count
+	maxHistogramBins = 1000
+
+	// maxPercentiles - max count of requested percentiles
+	maxPercentiles = 100
+
+	// statsDigestSize - max count of centroids of the series values digest, series with not more values
+	// keep all of them, so their percentiles and histograms are exact
+	statsDigestSize = 1000
+
+	// statsCompression - compression of the series values digest, merged digest has about statsCompression / 2 centroids
+	statsCompression = 500
+)
+
+// DefaultPercentiles - percentiles, which are computed, if they are not set
+var DefaultPercentiles = []float64{25, 50, 75, 90, 99}
+
+// StatsOptions - percentiles and histogram of the series statistics,
+// histogram range is the series values range, if it is not set
+type StatsOptions struct {
+	percentiles []float64
+	bins        int
+	min, max    *float64
+}
+
+// NewStatsOptions - returns stats options, percentiles are from 0 to 100
+func NewStatsOptions(percentiles []float64, bins int, min, max *float64) (*StatsOptions, error) {
+	if len(percentiles) > maxPercentiles {
+		return nil, errors.Errorf("too many percentiles %d", len(percentiles))
+	}
+
+	for _, p := range percentiles {
+		if !(p >= 0 && p <= 100) {
+			return nil, errors.Errorf("bad percentile %v", p)
+		}
+	}
+
+	if bins == 0 {
+		bins = DefaultHistogramBins
+	}
+
+	if bins < 0 || bins > maxHistogramBins {
+		return nil, errors.Errorf("bad histogram bins count %d", bins)
+	}
+
+	for _, bound := range []*float64{min, max} {
+		if bound != nil && (math.IsNaN(*bound) || math.IsInf(*bound, 0)) {
+			return nil, errors.New("bad histogram range")
+		}
+	}
+
+	if min != nil && max != nil && *min >= *max {
+		return nil, errors.New("bad histogram range")
+	}
+
+	return &StatsOptions{percentiles: percentiles, bins: bins, min: min, max: max}, nil
+}
+
+// StatsData - statistics of all series of the file data version
+type StatsData struct {
+	Version uint64
+	Series  []*SeriesStats
+}
+
+// SeriesStats - series statistics, NaN and infinite values are skipped, stddev is the population standard deviation,
+// values are omitted, if series has no values
+type SeriesStats struct {
+	Name        string        `json:"name"`
+	Count       int           `json:"count"`
+	Min         *float64      `json:"min,omitempty"`
+	Max         *float64      `json:"max,omitempty"`
+	Mean        *float64      `json:"mean,omitempty"`
+	StdDev      *float64      `json:"stddev,omitempty"`
+	Percentiles []*Percentile `json:"percentiles,omitempty"`
+	Histogram   *Histogram    `json:"histogram,omitempty"`
+}
+
+// Percentile - value of the p-th percentile, linearly interpolated between the closest ranks
+type Percentile struct {
+	P     float64 `json:"p"`
+	Value float64 `json:"value"`
+}
+
+// Histogram - counts of values in bins of equal width from min to max, the last bin includes max,
+// values outside of the range are not counted
+type Histogram struct {
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Counts []int   `json:"counts"`
+}
+
+// Stats - statistics of the file series, which is updated by appended points,
+// series values are kept in t-digest of bounded size, so percentiles and histograms of any options
+// are computed by it (they are exact, while series has not more than statsDigestSize values)
+type Stats struct {
+	version uint64
+	series  []*seriesStats
+	sync.RWMutex
+}
+
+type seriesStats struct {
+	name    string
+	moments moments
+	digest  digest
+}
+
+// NewStats - returns statistics of the file data
+func NewStats(data *FileData) *Stats {
+	s := &Stats{}
+	s.Reset(data)
+	return s
+}
+
+// Reset - recomputes statistics of the whole file data
+func (s *Stats) Reset(data *FileData) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.series = nil
+	s.add(data)
+	s.version = data.Version
+}
+
+// Add - adds appended points to the statistics, returns false, if they were already counted
+func (s *Stats) Add(tail *FileData) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if tail.Version <= s.version {
+		return false
+	}
+
+	s.add(tail)
+	s.version = tail.Version
+	return true
+}
+
+// Version - returns version of the file data, which is counted
+func (s *Stats) Version() uint64 {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.version
+}
+
+func (s *Stats) add(data *FileData) {
+	for i, series := range data.Series {
+		if i == len(s.series) {
+			s.series = append(s.series, &seriesStats{name: series.Name})
+		}
+
+		s.series[i].add(series.Values)
+	}
+}
+
+// add - updates mean and sum of squared deviations by Welford's algorithm and adds values to the digest
+func (s *seriesStats) add(values []float64) {
+	valid := make([]float64, 0, len(values))
+
+	for _, v := range values {
+		if finite(v) {
+			valid = append(valid, v)
+			s.moments.add(v)
+		}
+	}
+
+	sort.Float64s(valid)
+	s.digest.add(valid)
+}
+
+// Get - returns statistics with percentiles and histograms by options
+func (s *Stats) Get(opts *StatsOptions) *StatsData {
+	s.RLock()
+	defer s.RUnlock()
+
+	res := &StatsData{Version: s.version, Series: make([]*SeriesStats, 0, len(s.series))}
+
+	for _, series := range s.series {
+		res.Series = append(res.Series, series.get(opts))
+	}
+
+	return res
+}
+
+func (s *seriesStats) get(opts *StatsOptions) *SeriesStats {
+	n := s.digest.count
+	res := &SeriesStats{Name: s.name, Count: n}
+
+	if n == 0 {
+		return res
+	}
+
+	res.Min, res.Max = floatPtr(s.digest.min), floatPtr(s.digest.max)
+	res.Mean, res.StdDev = floatPtr(s.moments.mean), floatPtr(s.moments.std())
+
+	res.Percentiles = make([]*Percentile, 0, len(opts.percentiles))
+	for _, p := range opts.percentiles {
+		res.Percentiles = append(res.Percentiles, &Percentile{P: p, Value: s.digest.quantile(p / 100 * float64(n-1))})
+	}
+
+	res.Histogram = s.histogram(opts)
+	return res
+}
+
+func (s *seriesStats) histogram(opts *StatsOptions) *Histogram {
+	lo, hi := s.digest.min, s.digest.max
+
+	if opts.min != nil {
+		lo = *opts.min
+	}
+
+	if opts.max != nil {
+		hi = *opts.max
+	}
+
+	// all values are the same, so they are placed into the middle of the unit range
+	if lo == hi {
+		lo, hi = lo-0.5, hi+0.5
+	}
+
+	h := &Histogram{Min: lo, Max: hi, Counts: make([]int, opts.bins)}
+	if lo > hi {
+		return h
+	}
+
+	width := (hi - lo) / float64(opts.bins)
+	counts := make([]float64, opts.bins)
+
+	// bin - returns bin of the value, values at bins boundaries are counted in the upper bin
+	bin := func(v float64) int {
+		b := int((v - lo) / width)
+		for b > 0 && v < lo+float64(b)*width {
+			b--
+		}
+
+		for b < opts.bins-1 && v >= lo+float64(b+1)*width {
+			b++
+		}
+
+		if b >= opts.bins {
+			b = opts.bins - 1
+		}
+
+		return b
+	}
+
+	centroids := s.digest.centroids
+	for i, c := range centroids {
+		// values of the merged centroid are spread uniformly between middles of it and its neighbours
+		left, right := s.digest.min, s.digest.max
+		if i > 0 {
+			left = (centroids[i-1].mean + c.mean) / 2
+		}
+
+		if i < len(centroids)-1 {
+			right = (c.mean + centroids[i+1].mean) / 2
+		}
+
+		if c.count == 1 || left >= right {
+			if c.mean >= lo && c.mean <= hi {
+				counts[bin(c.mean)] += float64(c.count)
+			}
+
+			continue
+		}
+
+		from, to := math.Max(left, lo), math.Min(right, hi)
+		for b := bin(from); from < to && b < opts.bins; b++ {
+			end := math.Min(lo+float64(b+1)*width, to)
+			if b == opts.bins-1 {
+				end = to
+			}
+
+			counts[b] += float64(c.count) * (end - from) / (right - left)
+			from = end
+		}
+	}
+
+	for b, count := range counts {
+		h.Counts[b] = int(math.Round(count))
+	}
+
+	return h
+}
+
+// centroid - mean of the close values and their count
+type centroid struct {
+	mean  float64
+	count int
+}
+
+// digest - t-digest of values: centroids of the close values, sorted by mean, neighbour centroids are merged,
+// when there are more than statsDigestSize of them, so centroids at the tails are small and the median ones are large
+type digest struct {
+	centroids []centroid
+	count     int
+	min, max  float64
+}
+
+// add - adds sorted values to the digest
+func (d *digest) add(values []float64) {
+	if len(values) == 0 {
+		return
+	}
+
+	if d.count == 0 {
+		d.min, d.max = values[0], values[len(values)-1]
+	}
+
+	d.min = math.Min(d.min, values[0])
+	d.max = math.Max(d.max, values[len(values)-1])
+	d.count += len(values)
+
+	merged := make([]centroid, 0, len(d.centroids)+len(values))
+	i, j := 0, 0
+
+	for i < len(d.centroids) || j < len(values) {
+		if j == len(values) || i < len(d.centroids) && d.centroids[i].mean <= values[j] {
+			merged = append(merged, d.centroids[i])
+			i++
+		} else {
+			merged = append(merged, centroid{mean: values[j], count: 1})
+			j++
+		}
+	}
+
+	if len(merged) > statsDigestSize {
+		merged = compress(merged, d.count)
+	}
+
+	d.centroids = merged
+}
+
+// quantile - returns value of the rank (from 0 to count - 1), centroids are placed in the middle of their ranks
+// and values between them are linearly interpolated, so quantiles of not merged values are exact
+func (d *digest) quantile(rank float64) float64 {
+	prevRank, prevMean := 0.0, d.min
+	start := 0.0
+
+	for _, c := range d.centroids {
+		center := start + float64(c.count-1)/2
+
+		if rank <= center {
+			if center == prevRank {
+				return c.mean
+			}
+
+			return prevMean + (c.mean-prevMean)*(rank-prevRank)/(center-prevRank)
+		}
+
+		prevRank, prevMean = center, c.mean
+		start += float64(c.count)
+	}
+
+	last := float64(d.count - 1)
+	if last == prevRank {
+		return prevMean
+	}
+
+	return prevMean + (d.max-prevMean)*(rank-prevRank)/(last-prevRank)
+}
+
+// compress - merges neighbour centroids, while their quantile range is within the limit of the k1 scale function
+// k(q) = compression / 2π * asin(2q - 1), which grows by one for every merged centroid
+func compress(centroids []centroid, total int) []centroid {
+	res := make([]centroid, 0, statsCompression)
+	res = append(res, centroids[0])
+
+	done := 0
+	limit := quantileLimit(0)
+
+	for _, c := range centroids[1:] {
+		last := &res[len(res)-1]
+
+		if float64(done+last.count+c.count)/float64(total) <= limit {
+			last.count += c.count
+			last.mean += (c.mean - last.mean) * float64(c.count) / float64(last.count)
+			continue
+		}
+
+		done += last.count
+		limit = quantileLimit(float64(done) / float64(total))
+		res = append(res, c)
+	}
+
+	return res
+}
+
+// quantileLimit - returns max quantile of the centroid, which starts at quantile q
+func quantileLimit(q float64) float64 {
+	k := statsCompression/(2*math.Pi)*math.Asin(2*q-1) + 1
+	if k >= statsCompression/4 {
+		return 1
+	}
+
+	return (math.Sin(k*2*math.Pi/statsCompression) + 1) / 2
+}
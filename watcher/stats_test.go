@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestStatsExact(t *testing.T) {
+	inf := math.Inf(1)
+	data := newTestData([]string{"x", "loss", "empty"}, []float64{1, 2, 3, 4, 5, 6},
+		SeriesValues{4, nan, 1, -inf, 3, 2}, SeriesValues{nan, nan, inf, nan, nan, nan})
+
+	opts, err := NewStatsOptions([]float64{0, 25, 50, 90, 100}, 3, nil, nil)
+	if err != nil {
+		t.Fatalf("creating options failed: %v", err)
+	}
+
+	res := NewStats(data).Get(opts)
+	if len(res.Series) != 2 {
+		t.Fatalf("expected 2 series, got %d", len(res.Series))
+	}
+
+	loss := res.Series[0]
+	if loss.Count != 4 || *loss.Min != 1 || *loss.Max != 4 || *loss.Mean != 2.5 || !equalValues([]float64{*loss.StdDev}, []float64{math.Sqrt(1.25)}) {
+		t.Fatalf("expected count 4, min 1, max 4, mean 2.5, stddev %v, got %+v", math.Sqrt(1.25), loss)
+	}
+
+	percentiles := make([]float64, 0, len(loss.Percentiles))
+	for _, p := range loss.Percentiles {
+		percentiles = append(percentiles, p.Value)
+	}
+
+	if expected := []float64{1, 1.75, 2.5, 3.7, 4}; !equalValues(percentiles, expected) {
+		t.Errorf("expected percentiles %v, got %v", expected, percentiles)
+	}
+
+	if h := loss.Histogram; h.Min != 1 || h.Max != 4 || len(h.Counts) != 3 || h.Counts[0] != 1 || h.Counts[1] != 1 || h.Counts[2] != 2 {
+		t.Errorf("expected histogram from 1 to 4 with counts [1 1 2], got %+v", h)
+	}
+
+	if empty := res.Series[1]; empty.Count != 0 || empty.Min != nil || empty.Percentiles != nil || empty.Histogram != nil {
+		t.Errorf("expected empty statistics, got %+v", empty)
+	}
+}
+
+func TestStatsAdd(t *testing.T) {
+	data := newTestData([]string{"x", "y"}, []float64{1, 2}, SeriesValues{5, 1})
+	data.Version = 1
+
+	s := NewStats(data)
+
+	tail := newTestData([]string{"x", "y"}, []float64{3, 4}, SeriesValues{3, 7})
+	tail.Version = 2
+
+	if !s.Add(tail) {
+		t.Fatal("expected appended points to be added")
+	}
+
+	if s.Add(tail) {
+		t.Fatal("expected already counted points to be skipped")
+	}
+
+	opts, _ := NewStatsOptions([]float64{50}, 2, nil, floatPtr(5))
+	res := s.Get(opts)
+
+	if y := res.Series[0]; res.Version != 2 || y.Count != 4 || *y.Mean != 4 || y.Percentiles[0].Value != 4 {
+		t.Fatalf("expected version 2, count 4, mean 4 and median 4, got %d and %+v", res.Version, y)
+	}
+
+	// value above the histogram range is not counted, max is included to the last bin
+	if h := res.Series[0].Histogram; h.Min != 1 || h.Max != 5 || h.Counts[0] != 1 || h.Counts[1] != 2 {
+		t.Errorf("expected histogram from 1 to 5 with counts [1 2], got %+v", h)
+	}
+}
+
+func TestStatsDigest(t *testing.T) {
+	const n = 100000
+
+	s := NewStats(newTestData([]string{"x", "y"}, nil, SeriesValues{}))
+	values := rand.New(rand.NewSource(1)).Perm(n)
+
+	// points are appended in chunks of different size
+	for start, size := 0, 1; start < n; start, size = start+size, size%700+1 {
+		if start+size > n {
+			size = n - start
+		}
+
+		tail := newTestData([]string{"x", "y"}, nil, make(SeriesValues, 0, size))
+		for _, v := range values[start : start+size] {
+			tail.Series[0].Values = append(tail.Series[0].Values, float64(v))
+		}
+
+		tail.Version = uint64(start + 1)
+		s.Add(tail)
+	}
+
+	if count := len(s.series[0].digest.centroids); count > statsDigestSize {
+		t.Fatalf("expected at most %d centroids, got %d", statsDigestSize, count)
+	}
+
+	percentiles := []float64{0, 0.1, 1, 10, 25, 50, 75, 90, 99, 99.9, 100}
+	opts, _ := NewStatsOptions(percentiles, 10, nil, nil)
+	y := s.Get(opts).Series[0]
+
+	if y.Count != n || *y.Min != 0 || *y.Max != n-1 || !equalValues([]float64{*y.Mean}, []float64{(n - 1) / 2.0}) {
+		t.Fatalf("expected count %d, min 0, max %d and mean %v, got %+v", n, n-1, (n-1)/2.0, y)
+	}
+
+	for _, p := range y.Percentiles {
+		if expected := p.P / 100 * (n - 1); math.Abs(p.Value-expected) > 0.002*n {
+			t.Errorf("expected %v percentile %v, got %v", p.P, expected, p.Value)
+		}
+	}
+
+	for _, count := range y.Histogram.Counts {
+		if math.Abs(float64(count)-n/10) > 0.01*n {
+			t.Errorf("expected about %d values in each bin, got %v", n/10, y.Histogram.Counts)
+			break
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// fingerprintSize - count of bytes before the parsed offset,
+// which are compared to detect, that file was rewritten instead of appended
+const fingerprintSize = 64
+
+// tail - state of the incrementally parsed file
+type tail struct {
+	offset      int64
+	line        int
+	complete    bool
+	fingerprint []byte
+	columns     []string
+	sync.Mutex
+}
+
+// reset - resets tail state to the fully parsed file content
+func (t *tail) reset(b []byte, data *FileData) {
+	t.columns = data.Columns
+	t.offset = 0
+	t.line = 1
+	t.advance(b, b)
+}
+
+// advance - moves tail offset by the parsed lines, b is the file content up to the new offset
+func (t *tail) advance(b []byte, lines []byte) {
+	t.offset += int64(len(lines))
+	t.line += bytes.Count(lines, []byte("\n"))
+	t.complete = len(b) > 0 && b[len(b)-1] == '\n'
+
+	start := len(b) - fingerprintSize
+	if start < 0 {
+		start = 0
+	}
+
+	t.fingerprint = append(t.fingerprint[:0], b[start:]...)
+}
+
+// read - reads complete lines, appended after the tail offset, and returns them with the first line number,
+// returns false, if file was rewritten or truncated and should be fully reloaded
+func (t *tail) read(fullPath string) ([]byte, int, bool) {
+	if !t.valid() {
+		return nil, 0, false
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, 0, false
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() < t.offset {
+		return nil, 0, false
+	}
+
+	start := t.offset - int64(len(t.fingerprint))
+	b := make([]byte, info.Size()-start)
+
+	n, err := file.ReadAt(b, start)
+	if err != nil && err != io.EOF {
+		return nil, 0, false
+	}
+
+	b = b[:n]
+	if !bytes.HasPrefix(b, t.fingerprint) {
+		return nil, 0, false
+	}
+
+	appended := b[len(t.fingerprint):]
+
+	line := t.line
+
+	lastBreak := bytes.LastIndexByte(appended, '\n')
+	if lastBreak < 0 {
+		return appended[:0], line, true
+	}
+
+	lines := appended[:lastBreak+1]
+	t.advance(b[:len(t.fingerprint)+len(lines)], lines)
+	return lines, line, true
+}
+
+// valid - checks, if appended lines could be read after the tail offset
+func (t *tail) valid() bool {
+	return t.complete && t.offset != 0
+}
+
+// parsed - returns file content up to the tail offset, if the file is appended after the last read,
+// so lines, which are not parsed yet, are left for the append event, content is returned as is otherwise
+func (t *tail) parsed(b []byte) []byte {
+	if !t.valid() || int64(len(b)) < t.offset {
+		return b
+	}
+
+	start := t.offset - int64(len(t.fingerprint))
+	if !bytes.Equal(b[start:t.offset], t.fingerprint) {
+		return b
+	}
+
+	return b[:t.offset]
+}
+
+// invalidate - drops tail state, so the next read requires full reload of the file
+func (t *tail) invalidate() {
+	t.offset = 0
+	t.complete = false
+	t.fingerprint = t.fingerprint[:0]
+}
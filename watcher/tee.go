@@ -0,0 +1,55 @@
+package watcher
+
+import (
+	"context"
+)
+
+// teeWatcher - passes every event of the watcher to the listeners before sending it,
+// so several consumers are fed by the same events stream
+type teeWatcher struct {
+	Watcher
+
+	listeners []func(event *Event)
+	events    chan *Event
+}
+
+// NewTee - returns watcher, which passes events of w to the listeners, listeners should not block
+func NewTee(w Watcher, listeners ...func(event *Event)) Watcher {
+	return &teeWatcher{Watcher: w, listeners: listeners, events: make(chan *Event)}
+}
+
+func (t *teeWatcher) Start(ctx context.Context) error {
+	if err := t.Watcher.Start(ctx); err != nil {
+		return err
+	}
+
+	go t.forwardEvents(ctx)
+	return nil
+}
+
+func (t *teeWatcher) forwardEvents(ctx context.Context) {
+	updates := t.Watcher.UpdatesChannel()
+
+	for {
+		select {
+		case event := <-updates:
+			for _, listener := range t.listeners {
+				listener(event)
+			}
+
+			t.events <- event
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *teeWatcher) UpdatesChannel() <-chan *Event {
+	return t.events
+}
+
+// Unwrap - returns watcher, which events are passed to the listeners
+func (t *teeWatcher) Unwrap() Watcher {
+	return t.Watcher
+}
@@ -4,8 +4,14 @@ const CreateState = "CREATE"
 const ModifyState = "MODIFY"
 const RemoveState = "REMOVE"
 
+// AppendState - event type for data, appended to the end of file, event values contain only new points
+const AppendState = "APPEND"
+
 type Event struct {
 	Type   string    `json:"type"`
 	Name   string    `json:"name"`
 	Values *FileData `json:"data"`
+
+	// Alert - fired or resolved alert of the alert event
+	Alert *Alert `json:"alert,omitempty"`
 }
@@ -0,0 +1,498 @@
+package watcher
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lillilli/logger"
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// VirtualRootName - name of the pseudo root of virtual files, virtual files are named "virtual:name"
+const VirtualRootName = "virtual"
+
+// ErrUnknownVirtualFile - returns, when file name points to not defined virtual file
+var ErrUnknownVirtualFile = errors.New("unknown virtual file")
+
+// VirtualFiles - watcher, which allows to define and remove virtual files at runtime,
+// names of virtual files are passed without the virtual root name
+type VirtualFiles interface {
+	DefineDerived(cfg config.DerivedFile) error
+	DefineMerged(cfg config.MergedFile) error
+	RemoveVirtual(name string) error
+}
+
+// virtualFile - file, which data is computed from data of source files,
+// sources are full file names or glob patterns, matched against names of the watched files
+type virtualFile interface {
+	Patterns() []string
+	Format() string
+	Compute(sources []*FileData, names []string) (*FileData, error)
+}
+
+// virtualEntry - computed data of the virtual file with sources and their versions, it was computed from
+type virtualEntry struct {
+	sources  []string
+	versions []uint64
+	data     *FileData
+	computed time.Time
+}
+
+// virtualWatcher - adds virtual files to the source files watcher,
+// virtual file exists, while every source pattern matches some file, it is recomputed, when any source changes
+type virtualWatcher struct {
+	Watcher
+
+	files   map[string]virtualFile
+	present map[string]bool
+	entries map[string]*virtualEntry
+	version uint64
+	started bool
+
+	events chan *Event
+	log    logger.Logger
+	sync.RWMutex
+}
+
+// NewVirtual - returns watcher with virtual files, defined in config, over files of w
+func NewVirtual(w Watcher, derived []config.DerivedFile, merged []config.MergedFile) (Watcher, error) {
+	v := &virtualWatcher{
+		Watcher: w,
+		files:   make(map[string]virtualFile),
+		present: make(map[string]bool),
+		entries: make(map[string]*virtualEntry),
+		events:  make(chan *Event),
+		log:     logger.NewLogger("virtual watcher"),
+	}
+
+	for _, root := range w.Roots() {
+		if root.Name == VirtualRootName {
+			return nil, errors.Errorf("root name %q is reserved for virtual files", VirtualRootName)
+		}
+	}
+
+	for _, cfg := range derived {
+		if err := v.DefineDerived(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, cfg := range merged {
+		if err := v.DefineMerged(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// DefineDerived - adds virtual file with derived series
+func (v *virtualWatcher) DefineDerived(cfg config.DerivedFile) error {
+	file, err := newDerivedFile(cfg)
+	if err != nil {
+		return errors.Wrapf(err, "creating derived file %q failed", cfg.Name)
+	}
+
+	return v.define(cfg.Name, file)
+}
+
+// DefineMerged - adds virtual file, which merges source files
+func (v *virtualWatcher) DefineMerged(cfg config.MergedFile) error {
+	file, err := newMergedFile(cfg)
+	if err != nil {
+		return errors.Wrapf(err, "creating merged file %q failed", cfg.Name)
+	}
+
+	return v.define(cfg.Name, file)
+}
+
+// define - adds virtual file, file creation is sent, if watcher is started and file sources exist
+func (v *virtualWatcher) define(name string, file virtualFile) error {
+	if name == "" || strings.Contains(name, RootSeparator) {
+		return errors.Errorf("bad virtual file name %q", name)
+	}
+
+	name = v.fullName(name)
+
+	v.Lock()
+	if _, ok := v.files[name]; ok {
+		v.Unlock()
+		return errors.Errorf("duplicated virtual file name %q", name)
+	}
+
+	v.files[name] = file
+	started := v.started
+	v.Unlock()
+
+	if !started {
+		return nil
+	}
+
+	if _, ok := v.resolve(file); ok {
+		v.setPresent(name, true)
+		v.events <- &Event{Type: CreateState, Name: name}
+	}
+
+	return nil
+}
+
+// RemoveVirtual - removes virtual file, file removal is sent, if it existed
+func (v *virtualWatcher) RemoveVirtual(name string) error {
+	name = v.fullName(name)
+
+	v.Lock()
+	if _, ok := v.files[name]; !ok {
+		v.Unlock()
+		return ErrUnknownVirtualFile
+	}
+
+	present := v.present[name]
+	delete(v.files, name)
+	delete(v.present, name)
+	delete(v.entries, name)
+	v.Unlock()
+
+	if present {
+		v.events <- &Event{Type: RemoveState, Name: name}
+	}
+
+	return nil
+}
+
+func (v *virtualWatcher) Start(ctx context.Context) error {
+	if err := v.Watcher.Start(ctx); err != nil {
+		return err
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	for name, file := range v.files {
+		_, v.present[name] = v.resolve(file)
+	}
+
+	v.started = true
+
+	go v.forwardEvents(ctx)
+	return nil
+}
+
+// forwardEvents - sends source files events and events of virtual files, which depend on them
+func (v *virtualWatcher) forwardEvents(ctx context.Context) {
+	updates := v.Watcher.UpdatesChannel()
+
+	for {
+		select {
+		case event := <-updates:
+			v.events <- event
+
+			for _, dependent := range v.dependentEvents(event) {
+				v.events <- dependent
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dependentEvents - returns events of virtual files, which sources match the changed file,
+// virtual files are fully recomputed, so appended source points are sent as modification
+func (v *virtualWatcher) dependentEvents(event *Event) []*Event {
+	v.RLock()
+	names := make([]string, 0)
+	for name, file := range v.files {
+		if matchesAny(file.Patterns(), event.Name) {
+			names = append(names, name)
+		}
+	}
+	v.RUnlock()
+
+	sort.Strings(names)
+	events := make([]*Event, 0, len(names))
+
+	for _, name := range names {
+		v.RLock()
+		file, ok := v.files[name]
+		present := v.present[name]
+		v.RUnlock()
+
+		if !ok {
+			continue
+		}
+
+		if _, exists := v.resolve(file); !exists {
+			if present {
+				v.setPresent(name, false)
+				events = append(events, &Event{Type: RemoveState, Name: name})
+			}
+
+			continue
+		}
+
+		data, err := v.FileState(name)
+		if err != nil {
+			if errors.Cause(err) != ErrNotWatched {
+				v.log.Warnf("Computing virtual file %q failed: %v", name, err)
+			}
+
+			continue
+		}
+
+		if !present {
+			v.setPresent(name, true)
+			events = append(events, &Event{Type: CreateState, Name: name})
+		}
+
+		events = append(events, &Event{Type: ModifyState, Name: name, Values: data})
+	}
+
+	return events
+}
+
+func (v *virtualWatcher) setPresent(name string, present bool) {
+	v.Lock()
+	defer v.Unlock()
+
+	if _, ok := v.files[name]; !ok {
+		return
+	}
+
+	v.present[name] = present
+	if !present {
+		delete(v.entries, name)
+	}
+}
+
+func (v *virtualWatcher) UpdatesChannel() <-chan *Event {
+	return v.events
+}
+
+// Unwrap - returns watcher of the source files
+func (v *virtualWatcher) Unwrap() Watcher {
+	return v.Watcher
+}
+
+// State - returns names of source files and existing virtual files
+func (v *virtualWatcher) State() []string {
+	return append(v.Watcher.State(), v.virtualNames()...)
+}
+
+// Roots - returns source roots and the virtual root, if there are virtual files
+func (v *virtualWatcher) Roots() []RootState {
+	roots := v.Watcher.Roots()
+
+	names := v.virtualNames()
+	if len(names) == 0 {
+		return roots
+	}
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		files = append(files, strings.TrimPrefix(name, VirtualRootName+RootSeparator))
+	}
+
+	return append(roots, RootState{Name: VirtualRootName, Files: files})
+}
+
+// Listing - returns source roots and the virtual root with virtual files metadata,
+// size of virtual file is 0 and its modification time is the last computation time
+func (v *virtualWatcher) Listing() []RootListing {
+	roots := v.Watcher.Listing()
+
+	names := v.virtualNames()
+	if len(names) == 0 {
+		return roots
+	}
+
+	files := make([]*FileInfo, 0, len(names))
+
+	for _, name := range names {
+		data, err := v.FileState(name)
+		if err != nil {
+			continue
+		}
+
+		info := &FileInfo{Name: strings.TrimPrefix(name, VirtualRootName+RootSeparator)}
+
+		v.RLock()
+		if file, ok := v.files[name]; ok {
+			info.Format = file.Format()
+		}
+
+		if entry, ok := v.entries[name]; ok {
+			info.ModTime = entry.computed
+		}
+		v.RUnlock()
+
+		newSummary(data, false).fill(info)
+		files = append(files, info)
+	}
+
+	return append(roots, RootListing{Name: VirtualRootName, Files: files})
+}
+
+// FileState - returns data of the source or virtual file, virtual file is recomputed, if its sources were changed
+func (v *virtualWatcher) FileState(name string) (*FileData, error) {
+	if !strings.HasPrefix(name, VirtualRootName+RootSeparator) {
+		return v.Watcher.FileState(name)
+	}
+
+	v.RLock()
+	file, ok := v.files[name]
+	v.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownVirtualFile
+	}
+
+	names, ok := v.resolve(file)
+	if !ok {
+		return nil, errors.Wrapf(ErrNotWatched, "no source files of %q", name)
+	}
+
+	sources := make([]*FileData, 0, len(names))
+	versions := make([]uint64, 0, len(names))
+
+	for _, source := range names {
+		data, err := v.Watcher.FileState(source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading source file %q failed", source)
+		}
+
+		sources = append(sources, data)
+		versions = append(versions, data.Version)
+	}
+
+	if entry, ok := v.entry(name, names, versions); ok {
+		return entry.data, nil
+	}
+
+	data, err := file.Compute(sources, names)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	// entry could be computed concurrently, so the same sources should give the same data version
+	if entry, ok := v.entries[name]; ok && entry.matches(names, versions) {
+		return entry.data, nil
+	}
+
+	v.version++
+	data.Version = v.version
+
+	if _, ok := v.files[name]; ok {
+		v.entries[name] = &virtualEntry{sources: names, versions: versions, data: data, computed: time.Now()}
+	}
+
+	return data, nil
+}
+
+// entry - returns computed data of the virtual file, if it was computed from the same sources
+func (v *virtualWatcher) entry(name string, sources []string, versions []uint64) (*virtualEntry, bool) {
+	v.RLock()
+	defer v.RUnlock()
+
+	entry, ok := v.entries[name]
+	if !ok || !entry.matches(sources, versions) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// RangeQuery - returns points of the source or virtual file in x range, virtual files have no pyramids
+func (v *virtualWatcher) RangeQuery(name string, from, to float64, width int) (*RangeData, error) {
+	if !strings.HasPrefix(name, VirtualRootName+RootSeparator) {
+		return v.Watcher.RangeQuery(name, from, to, width)
+	}
+
+	data, err := v.FileState(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rangeQuery(data, nil, from, to, width), nil
+}
+
+// resolve - returns sorted names of the virtual file sources, returns false, if some source pattern matches no files
+func (v *virtualWatcher) resolve(file virtualFile) ([]string, bool) {
+	state := v.Watcher.State()
+	names := make([]string, 0)
+	added := make(map[string]bool)
+
+	for _, pattern := range file.Patterns() {
+		matched := make([]string, 0)
+		for _, name := range state {
+			if ok, _ := path.Match(pattern, name); ok && !added[name] {
+				matched = append(matched, name)
+				added[name] = true
+			}
+		}
+
+		if len(matched) == 0 && !matchesAny([]string{pattern}, names...) {
+			return nil, false
+		}
+
+		sort.Strings(matched)
+		names = append(names, matched...)
+	}
+
+	return names, true
+}
+
+// virtualNames - returns sorted full names of existing virtual files
+func (v *virtualWatcher) virtualNames() []string {
+	v.RLock()
+	defer v.RUnlock()
+
+	names := make([]string, 0, len(v.present))
+	for name, present := range v.present {
+		if present {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (v *virtualWatcher) fullName(name string) string {
+	return VirtualRootName + RootSeparator + name
+}
+
+// matchesAny - checks, if some of the names matches some of the patterns
+func matchesAny(patterns []string, names ...string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (e *virtualEntry) matches(sources []string, versions []uint64) bool {
+	if len(e.sources) != len(sources) {
+		return false
+	}
+
+	for i := range sources {
+		if e.sources[i] != sources[i] || e.versions[i] != versions[i] {
+			return false
+		}
+	}
+
+	return true
+}
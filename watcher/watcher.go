@@ -3,18 +3,60 @@ package watcher
 import (
 	"context"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/lillilli/logger"
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
 )
 
+const (
+	// minRestartBackoff - delay before the first restart of failed backend
+	minRestartBackoff = time.Second
+
+	// maxRestartBackoff - max delay between restarts of failed backend
+	maxRestartBackoff = time.Minute
+)
+
+// ErrNotWatched - returns, when requested file is filtered out
+var ErrNotWatched = errors.New("file is not watched")
+
+// ErrOutsideWatchDir - returns, when requested file name points outside of the watch dir
+var ErrOutsideWatchDir = errors.New("file is outside of the watch dir")
+
 type watcher struct {
-	dir    string
-	files  map[string]bool
-	events chan *Event
-	log    logger.Logger
+	name    string
+	dir     string
+	filter  *filter
+	files   map[string]string // logical file name (without compression extension) -> file name on disk
+	dirs    map[string]bool
+	tails   map[string]*tail
+	parsers *Registry
+
+	cache     *cache
+	summaries map[string]*summary
+	pyramids  map[string]*pyramid
+	building  map[string]bool
+	versions  map[string]uint64
+	version   uint64
+
+	health *health
+
+	events  chan *Event
+	updates *debouncer
+
+	backend      string
+	pollInterval time.Duration
+	maxWarnings  int
+
+	log logger.Logger
 	sync.RWMutex
 }
 
@@ -24,112 +66,742 @@ type Watcher interface {
 
 	State() []string
 	FileState(name string) (*FileData, error)
+	Roots() []RootState
+	Listing() []RootListing
+	RangeQuery(name string, from, to float64, width int) (*RangeData, error)
+	Health() Health
 }
 
-func New(dir string) Watcher {
-	return &watcher{
-		dir:    dir,
-		files:  make(map[string]bool),
-		events: make(chan *Event),
-		log:    logger.NewLogger("watcher"),
+// RootState - watch root with its files
+type RootState struct {
+	Name  string   `json:"name"`
+	Files []string `json:"files"`
+}
+
+// New - returns watcher of the root dir, root parser settings override the watcher ones
+func New(root config.Root, cfg config.Watcher) (Watcher, error) {
+	parsers, err := newRootRegistry(root, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	include := cfg.Include
+	if len(root.Include) != 0 {
+		include = root.Include
 	}
+
+	filter, err := newFilter(include, append(append([]string{}, cfg.Exclude...), root.Exclude...))
+	if err != nil {
+		return nil, err
+	}
+
+	// poll backend could be chosen by auto backend, ticker of not positive interval panics
+	if cfg.Backend != FSNotifyBackend && cfg.Backend != "" && cfg.PollInterval <= 0 {
+		return nil, errors.Errorf("bad poll interval %s", cfg.PollInterval)
+	}
+
+	return &watcher{
+		name:    root.Name,
+		dir:     filepath.Clean(root.Dir),
+		filter:  filter,
+		files:   make(map[string]string),
+		dirs:    make(map[string]bool),
+		tails:   make(map[string]*tail),
+		parsers: parsers,
+
+		cache:     newCache(cfg.CacheBudget),
+		summaries: make(map[string]*summary),
+		pyramids:  make(map[string]*pyramid),
+		building:  make(map[string]bool),
+		versions:  make(map[string]uint64),
+
+		events:  make(chan *Event),
+		updates: newDebouncer(cfg.QuietPeriod, cfg.MaxLatency),
+		health:  newHealth(cfg.Backend),
+		log:     logger.NewLogger("watcher " + root.Name),
+
+		backend:      cfg.Backend,
+		pollInterval: cfg.PollInterval,
+		maxWarnings:  cfg.MaxWarnings,
+	}, nil
 }
 
 func (w *watcher) Start(ctx context.Context) error {
-	if err := w.updateFilesCache(); err != nil {
+	if err := w.filter.loadIgnoreFile(w.fullPath(IgnoreFileName)); err != nil {
+		return errors.Wrap(err, "loading ignore file failed")
+	}
+
+	watcher, err := w.newNotifier()
+	if err != nil {
+		return err
+	}
+
+	files, err := w.addDir(watcher, w.dir)
+	if err != nil {
+		watcher.Close()
 		return err
 	}
 
-	watcher, err := fsnotify.NewWatcher()
+	w.addFiles(files)
+
+	go w.run(ctx, watcher)
+	go w.processUpdates(ctx)
+	return nil
+}
+
+// addFiles - adds found files by their logical names, uncompressed file is preferred,
+// if there are several files with the same logical name
+func (w *watcher) addFiles(files []string) {
+	w.Lock()
+	defer w.Unlock()
+
+	for _, fileName := range files {
+		name := logicalName(fileName)
+
+		known, ok := w.files[name]
+		if !ok {
+			w.files[name] = fileName
+			continue
+		}
+
+		if fileRank(fileName) < fileRank(known) {
+			known, fileName = fileName, known
+		}
+
+		w.log.Warnf("Files %q and %q have the same name %q, %q is watched", known, fileName, name, known)
+		w.files[name] = known
+	}
+}
+
+// run - watches file system events, restarts the backend with backoff, if it fails
+func (w *watcher) run(ctx context.Context, watcher notifier) {
+	backoff := minRestartBackoff
+	lastRestart := time.Time{}
+
+	for {
+		err := w.startWatch(ctx, watcher)
+		if err == nil {
+			return
+		}
+
+		w.health.degraded(err)
+
+		if time.Since(lastRestart) > maxRestartBackoff {
+			backoff = minRestartBackoff
+		}
+
+		for {
+			w.log.Warnf("Restarting watcher in %s", backoff)
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+
+			if backoff *= 2; backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+
+			if watcher, err = w.restart(); err == nil {
+				break
+			}
+
+			w.log.Errorf("Restarting watcher failed: %v", err)
+		}
+
+		lastRestart = time.Now()
+		w.health.restarted()
+		w.log.Info("Watcher restarted")
+	}
+}
+
+// restart - creates new backend and rescans the watch dir
+func (w *watcher) restart() (notifier, error) {
+	watcher, err := w.newNotifier()
+	if err != nil {
+		return nil, err
+	}
+
+	w.Lock()
+	w.dirs = make(map[string]bool)
+	w.Unlock()
+
+	if err := w.rescan(watcher); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+// rescan - walks the watch dir and queues updates for files, which differ from the known ones
+// (changes, which were missed during the backend failure, or files, which are filtered now)
+func (w *watcher) rescan(watcher notifier) error {
+	files, err := w.addDir(watcher, w.dir)
 	if err != nil {
 		return err
 	}
 
-	go w.startWatch(ctx, watcher)
-	return watcher.Add(w.dir)
+	found := make(map[string]bool, len(files))
+	for _, fileName := range files {
+		found[fileName] = true
+	}
+
+	w.RLock()
+	known := make([]string, 0, len(w.files))
+	for _, fileName := range w.files {
+		known = append(known, fileName)
+	}
+	w.RUnlock()
+
+	// modification of known file is checked by the tail state, so unchanged files are not sent again
+	for _, fileName := range known {
+		if found[fileName] {
+			w.updates.add(fileName, w.fullPath(fileName), fsnotify.Write)
+			delete(found, fileName)
+			continue
+		}
+
+		w.updates.add(fileName, w.fullPath(fileName), fsnotify.Remove)
+	}
+
+	for fileName := range found {
+		w.updates.add(fileName, w.fullPath(fileName), fsnotify.Create)
+	}
+
+	return nil
 }
 
-func (w *watcher) startWatch(ctx context.Context, watcher *fsnotify.Watcher) {
+// startWatch - handles backend events, returns error, if backend failed
+func (w *watcher) startWatch(ctx context.Context, watcher notifier) error {
 	for {
 		select {
-		case event := <-watcher.Events:
-			fileName := strings.TrimPrefix(event.Name, w.dir+"/")
+		case event := <-watcher.Events():
+			fileName := w.relativeName(event.Name)
 
-			if event.Op&fsnotify.Rename == fsnotify.Rename {
-				w.log.Debugf("File %q renamed", fileName)
-				delete(w.files, fileName)
-				w.events <- &Event{Type: RemoveState, Name: fileName}
+			if fileName == IgnoreFileName {
+				w.log.Infof("Ignore file changed, rescanning %q", w.dir)
+				w.reloadIgnoreFile(watcher)
+				continue
 			}
 
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				w.log.Debugf("File %q modified", fileName)
-				go w.handleFileModify(event.Name, fileName, ModifyState)
+			if event.Op&(fsnotify.Rename|fsnotify.Remove) != 0 && w.isDir(fileName) {
+				w.log.Debugf("Dir %q removed", fileName)
+				w.removeDir(watcher, fileName)
+				continue
 			}
 
 			if event.Op&fsnotify.Create == fsnotify.Create {
-				w.log.Debugf("File %q created", fileName)
-				w.files[fileName] = true
-				go w.handleFileModify(event.Name, fileName, CreateState)
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if !w.filter.allowedDir(fileName) {
+						continue
+					}
+
+					w.log.Debugf("Dir %q created", fileName)
+
+					files, err := w.addDir(watcher, event.Name)
+					if err != nil {
+						w.log.Errorf("Watching dir %q failed: %v", fileName, err)
+					}
+
+					for _, fileName := range files {
+						w.updates.add(fileName, w.fullPath(fileName), fsnotify.Create)
+					}
+
+					continue
+				}
 			}
 
-		case err := <-watcher.Errors:
+			w.log.Debugf("File %q event: %s", fileName, event.Op)
+			w.updates.add(fileName, event.Name, event.Op)
+
+		case err := <-watcher.Errors():
 			w.log.Errorf("Watcher return error: %v", err)
 			watcher.Close()
-			return
+			return err
 
 		case <-ctx.Done():
 			watcher.Close()
+			return nil
+		}
+	}
+}
+
+// reloadIgnoreFile - applies changed ignore file to the watched files
+func (w *watcher) reloadIgnoreFile(watcher notifier) {
+	if err := w.filter.loadIgnoreFile(w.fullPath(IgnoreFileName)); err != nil {
+		w.log.Errorf("Loading ignore file failed: %v", err)
+		return
+	}
+
+	if err := w.rescan(watcher); err != nil {
+		w.log.Errorf("Rescanning dir failed: %v", err)
+	}
+}
+
+// addDir - walks the dir tree, adds watches for every allowed dir and returns found data files
+func (w *watcher) addDir(watcher notifier, root string) ([]string, error) {
+	files := make([]string, 0)
+
+	err := filepath.Walk(root, func(fullPath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fileName := w.relativeName(fullPath)
+
+		if fileInfo.IsDir() {
+			if !w.filter.allowedDir(fileName) {
+				return filepath.SkipDir
+			}
+
+			if err := watcher.Add(fullPath); err != nil {
+				return errors.Wrapf(err, "watching dir %q failed", fullPath)
+			}
+
+			w.Lock()
+			w.dirs[fileName] = true
+			w.Unlock()
+			return nil
+		}
+
+		if w.admitted(fileName) {
+			files = append(files, fileName)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// removeDir - drops watches for the dir and all of its subdirs, files removal is checked on update
+func (w *watcher) removeDir(watcher notifier, dirName string) {
+	prefix := dirName + "/"
+	removed := make([]string, 0)
+
+	w.Lock()
+
+	for name := range w.dirs {
+		if name == dirName || strings.HasPrefix(name, prefix) {
+			delete(w.dirs, name)
+			// watch could be already dropped by the os, so error is useless here
+			_ = watcher.Remove(w.fullPath(name))
+		}
+	}
+
+	for _, name := range w.files {
+		if strings.HasPrefix(name, prefix) {
+			removed = append(removed, name)
+		}
+	}
+
+	w.Unlock()
+
+	for _, name := range removed {
+		w.updates.add(name, w.fullPath(name), fsnotify.Remove)
+	}
+}
+
+// processUpdates - handles coalesced file updates one by one, so events are sent in order
+func (w *watcher) processUpdates(ctx context.Context) {
+	updates := w.updates.updates()
+
+	for {
+		select {
+		case update := <-updates:
+			w.handleUpdate(update)
+
+		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (w *watcher) updateFilesCache() error {
-	fileInfos, err := ioutil.ReadDir(w.dir)
-	if err != nil {
-		return err
+// handleUpdate - resolves coalesced file operations into event by the current file state:
+// new file is created, existing file is modified (so rename over the file is a modification too),
+// known file, which does not exist anymore (or is filtered out), is removed; chmod alone does not change file content.
+// File is sent by its logical name, so replacing foo.txt with foo.txt.gz is a modification of foo.txt,
+// if both of them exist, foo.txt is watched and foo.txt.gz is watched only after removal of foo.txt
+func (w *watcher) handleUpdate(update *pendingUpdate) {
+	name := logicalName(update.name)
+	fileName, exists := w.lookupFile(name, update.name)
+
+	w.Lock()
+	known, ok := w.files[name]
+
+	switch {
+	case exists && !ok:
+		w.files[name] = fileName
+		w.Unlock()
+
+		w.log.Debugf("File %q created", fileName)
+		w.handleFileModify(w.fullPath(fileName), name, CreateState)
+
+	case exists && (known != fileName || (fileName == update.name && update.op&^fsnotify.Chmod != 0)):
+		w.files[name] = fileName
+
+		// tail of the other file is useless
+		if known != fileName {
+			delete(w.tails, name)
+		}
+
+		w.Unlock()
+
+		w.log.Debugf("File %q modified", fileName)
+		w.handleFileModify(w.fullPath(fileName), name, ModifyState)
+
+	case !exists && ok:
+		delete(w.files, name)
+		delete(w.tails, name)
+		delete(w.versions, name)
+		delete(w.summaries, name)
+		delete(w.pyramids, name)
+		w.Unlock()
+
+		w.log.Debugf("File %q removed", known)
+		w.cache.remove(name)
+		w.events <- &Event{Type: RemoveState, Name: name}
+
+	default:
+		w.Unlock()
+	}
+}
+
+// lookupFile - returns the preferred existing file of the logical name, updated file is checked too,
+// as its compression extension could be in other case, returns false, if there are no such files
+func (w *watcher) lookupFile(name, updated string) (string, bool) {
+	candidates := fileNames(name)
+	if fileRank(updated) != 0 && updated != candidates[fileRank(updated)] {
+		candidates = append(candidates, updated)
 	}
 
-	for _, fileInfo := range fileInfos {
-		fileName := fileInfo.Name()
+	found := make([]string, 0, 1)
 
-		if fileInfo.IsDir() || !strings.HasSuffix(fileName, ".txt") {
-			continue
+	for _, fileName := range candidates {
+		info, err := os.Stat(w.fullPath(fileName))
+		if err == nil && !info.IsDir() && w.admitted(fileName) {
+			found = append(found, fileName)
 		}
+	}
 
-		w.files[fileName] = true
+	if len(found) == 0 {
+		return "", false
 	}
 
-	return nil
+	if len(found) > 1 {
+		w.log.Warnf("Files %q have the same name %q, %q is watched", found, name, found[0])
+	}
+
+	return found[0], true
 }
 
+// handleFileModify - sends event of the file modification, event is sent after the file tail is unlocked,
+// so file state could be read by events consumers
 func (w *watcher) handleFileModify(fullPath, name, modifyType string) {
-	b, err := ioutil.ReadFile(fullPath)
+	if event := w.modifyFile(fullPath, name, modifyType); event != nil {
+		w.events <- event
+	}
+}
+
+// modifyFile - parses only appended lines, if it is possible, otherwise reloads the whole file,
+// compressed files are always reloaded, returns nil, if there is nothing to send
+func (w *watcher) modifyFile(fullPath, name, modifyType string) *Event {
+	t := w.tail(name)
+	t.Lock()
+	defer t.Unlock()
+
+	if modifyType == ModifyState {
+		if data, ok := w.readTail(t, fullPath, name); ok {
+			if data.Len() == 0 && data.WarningsCount == 0 {
+				return nil
+			}
+
+			prevVersion := w.fileVersion(name)
+			data.Version = w.nextVersion(name)
+			w.mergeCached(name, data)
+			w.mergeSummary(name, data)
+			w.extendPyramid(name, data, prevVersion)
+			return &Event{Type: AppendState, Name: name, Values: data}
+		}
+	}
+
+	b, compressed, err := w.readFile(fullPath)
 	if err != nil {
 		w.log.Errorf("Reading file failed: %v", err)
+		return nil
+	}
+
+	data, err := w.parseFile(b, name)
+	if err != nil {
+		w.log.Errorf("Parsing file failed: %v", err)
+		return nil
+	}
+
+	if compressed {
+		t.invalidate()
+	} else {
+		t.reset(b, data)
+	}
+
+	data.Version = w.nextVersion(name)
+	w.cache.put(name, data, true)
+	w.setSummary(name, data, true)
+	w.buildPyramid(name, data)
+	return &Event{Type: modifyType, Name: name, Values: data}
+}
+
+// mergeCached - appends tail to the cached file data,
+// data, which was read independently of the tail state, is dropped
+func (w *watcher) mergeCached(name string, tail *FileData) {
+	entry, ok := w.cache.entry(name)
+	if !ok {
+		return
+	}
+
+	if !entry.mergeable {
+		w.cache.remove(name)
 		return
 	}
 
-	w.events <- &Event{Type: modifyType, Name: name, Values: parseFile(b)}
+	merged := entry.data.Merge(tail)
+	merged.LimitWarnings(w.maxWarnings)
+	w.cache.put(name, merged, true)
+}
+
+// nextVersion - sets and returns new version of the file data
+func (w *watcher) nextVersion(name string) uint64 {
+	w.Lock()
+	defer w.Unlock()
+
+	w.version++
+	w.versions[name] = w.version
+	return w.version
+}
+
+// fileVersion - returns current version of the file data
+func (w *watcher) fileVersion(name string) uint64 {
+	w.Lock()
+	defer w.Unlock()
+
+	version, ok := w.versions[name]
+	if !ok {
+		w.version++
+		version = w.version
+		w.versions[name] = version
+	}
+
+	return version
 }
 
+// readTail - parses lines, appended after the last read,
+// returns false, if parser is not able to parse tails or file was rewritten
+func (w *watcher) readTail(t *tail, fullPath, name string) (*FileData, bool) {
+	parser, _, ok := w.parsers.Lookup(name)
+	if !ok {
+		return nil, false
+	}
+
+	tailParser, ok := parser.(TailParser)
+	if !ok {
+		return nil, false
+	}
+
+	b, line, ok := t.read(fullPath)
+	if !ok {
+		return nil, false
+	}
+
+	data, err := tailParser.ParseTail(b, t.columns, line)
+	if err != nil {
+		w.log.Warnf("Parsing appended lines of %q failed: %v", name, err)
+		return nil, false
+	}
+
+	data.LimitWarnings(w.maxWarnings)
+	return data, true
+}
+
+// tail - returns incremental parsing state for the file
+func (w *watcher) tail(name string) *tail {
+	w.Lock()
+	defer w.Unlock()
+
+	t, ok := w.tails[name]
+	if !ok {
+		t = &tail{}
+		w.tails[name] = t
+	}
+
+	return t
+}
+
+// State - returns logical names of the watched files, sorted by name
 func (w *watcher) State() []string {
 	files := make([]string, 0)
 	w.RLock()
 
-	for fileName := range w.files {
-		files = append(files, fileName)
+	for name := range w.files {
+		files = append(files, name)
 	}
 
 	w.RUnlock()
+	sort.Strings(files)
 	return files
 }
 
+// FileState - returns cached file data by the logical file name, file is read from disk only on cache miss,
+// lines, appended after the last processed update, are not read, so they are sent only by the append event
 func (w *watcher) FileState(name string) (*FileData, error) {
-	b, err := ioutil.ReadFile(w.dir + "/" + name)
-	return parseFile(b), err
+	fullPath, err := w.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	name = logicalName(name)
+
+	if data, ok := w.cache.get(name); ok {
+		return data, nil
+	}
+
+	w.RLock()
+	fileName, ok := w.files[name]
+	w.RUnlock()
+
+	if !ok {
+		fileName = name
+	}
+
+	if !w.admitted(fileName) {
+		return nil, ErrNotWatched
+	}
+
+	var t *tail
+
+	// file version and tail offset are not changed during reading, while tail is locked
+	if ok {
+		fullPath = w.fullPath(fileName)
+		t = w.tail(name)
+		t.Lock()
+		defer t.Unlock()
+	}
+
+	version := w.fileVersion(name)
+
+	b, compressed, err := w.readFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if t != nil && !compressed {
+		b = t.parsed(b)
+	}
+
+	data, err := w.parseFile(b, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Version = version
+
+	// file could be updated during reading, so stale data is not cached
+	if w.fileVersion(name) == version {
+		w.cache.put(name, data, false)
+		w.setSummary(name, data, false)
+
+		// the version content is fixed by the first reading, later lines are read as appended
+		if t != nil && !compressed && !t.valid() {
+			t.reset(b, data)
+		}
+	}
+
+	return data, nil
+}
+
+// Roots - returns the watcher root with its files
+func (w *watcher) Roots() []RootState {
+	return []RootState{{Name: w.name, Files: w.State()}}
+}
+
+// Health - returns watcher health state
+func (w *watcher) Health() Health {
+	return w.health.get()
 }
 
 func (w *watcher) UpdatesChannel() <-chan *Event {
 	return w.events
 }
+
+// readFile - reads file content, compressed file is decompressed, returns true in this case
+func (w *watcher) readFile(fullPath string) ([]byte, bool, error) {
+	b, err := ioutil.ReadFile(fullPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return decompress(fullPath, b)
+}
+
+// parseFile - parses file content with the parser, chosen for file name
+func (w *watcher) parseFile(b []byte, name string) (*FileData, error) {
+	parser, _, ok := w.parsers.Lookup(name)
+	if !ok {
+		return nil, ErrNoParser
+	}
+
+	data, err := parser.Parse(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing file %q failed", name)
+	}
+
+	data.LimitWarnings(w.maxWarnings)
+	return data, nil
+}
+
+// resolve - returns full path for the relative file name,
+// names, which are pointing outside of the watch dir, are refused
+func (w *watcher) resolve(name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", ErrOutsideWatchDir
+	}
+
+	fullPath := w.fullPath(name)
+
+	rel, err := filepath.Rel(w.dir, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideWatchDir
+	}
+
+	return fullPath, nil
+}
+
+// admitted - checks, if file should be watched: it has known format and is allowed by filter
+func (w *watcher) admitted(name string) bool {
+	if _, _, ok := w.parsers.Lookup(name); !ok {
+		return false
+	}
+
+	return w.filter.allowedFile(name)
+}
+
+func (w *watcher) isDir(name string) bool {
+	w.RLock()
+	defer w.RUnlock()
+
+	return w.dirs[name]
+}
+
+// relativeName - returns slash separated file name relative to the watch dir
+func (w *watcher) relativeName(fullPath string) string {
+	rel, err := filepath.Rel(w.dir, fullPath)
+	if err != nil {
+		return filepath.ToSlash(fullPath)
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+func (w *watcher) fullPath(name string) string {
+	return filepath.Join(w.dir, filepath.FromSlash(name))
+}
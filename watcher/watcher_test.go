@@ -0,0 +1,206 @@
+package watcher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/lillilli/graphex/config"
+)
+
+// newTestWatcher - returns not started watcher of the temp dir, updates are handled by handle
+func newTestWatcher(t *testing.T) (*watcher, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "graphex-watcher")
+	if err != nil {
+		t.Fatalf("creating temp dir failed: %v", err)
+	}
+
+	w, err := New(config.Root{Name: "test", Dir: dir}, config.Watcher{CSV: config.CSVParser{Comment: "#"}})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("creating watcher failed: %v", err)
+	}
+
+	return w.(*watcher), dir
+}
+
+// handle - handles file update and returns its event, returns nil, if nothing is sent
+func handle(w *watcher, name string, op fsnotify.Op) *Event {
+	done := make(chan struct{})
+
+	go func() {
+		w.handleUpdate(&pendingUpdate{name: name, fullPath: w.fullPath(name), op: op})
+		close(done)
+	}()
+
+	select {
+	case event := <-w.events:
+		<-done
+		return event
+	case <-done:
+		return nil
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, content string, flag int) {
+	t.Helper()
+
+	f, err := os.OpenFile(filepath.Join(dir, name), flag|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("opening %q failed: %v", name, err)
+	}
+
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("writing %q failed: %v", name, err)
+	}
+
+	f.Close()
+}
+
+func checkEvent(t *testing.T, event *Event, eventType string, x []float64) {
+	t.Helper()
+
+	if event == nil {
+		t.Fatalf("expected %s event, got nothing", eventType)
+	}
+
+	if event.Type != eventType {
+		t.Fatalf("expected %s event, got %s", eventType, event.Type)
+	}
+
+	if x != nil && !equalValues(event.Values.X, x) {
+		t.Fatalf("expected %s of x %v, got %v", eventType, x, event.Values.X)
+	}
+}
+
+func TestWatcherAppends(t *testing.T) {
+	w, dir := newTestWatcher(t)
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, dir, "a.csv", "x,y\n1,1\n2,2\n", os.O_TRUNC)
+	created := handle(w, "a.csv", fsnotify.Create)
+	checkEvent(t, created, CreateState, []float64{1, 2})
+
+	writeTestFile(t, dir, "a.csv", "3,3\n4,4\n", os.O_APPEND)
+	appended := handle(w, "a.csv", fsnotify.Write)
+	checkEvent(t, appended, AppendState, []float64{3, 4})
+
+	if appended.Values.Version <= created.Values.Version {
+		t.Fatalf("append version %d is not greater than %d", appended.Values.Version, created.Values.Version)
+	}
+
+	// incomplete line is parsed, when it is completed
+	writeTestFile(t, dir, "a.csv", "5,", os.O_APPEND)
+	if event := handle(w, "a.csv", fsnotify.Write); event != nil {
+		t.Fatalf("unexpected %s event of incomplete line", event.Type)
+	}
+
+	writeTestFile(t, dir, "a.csv", "5\n", os.O_APPEND)
+	checkEvent(t, handle(w, "a.csv", fsnotify.Write), AppendState, []float64{5})
+
+	data, err := w.FileState("a.csv")
+	if err != nil {
+		t.Fatalf("reading file state failed: %v", err)
+	}
+
+	if !equalValues(data.X, []float64{1, 2, 3, 4, 5}) || !equalValues(data.Series[0].Values, []float64{1, 2, 3, 4, 5}) {
+		t.Fatalf("unexpected merged file state: %v, %v", data.X, data.Series[0].Values)
+	}
+
+	// rewritten file of the same size, truncated file and appended file with changed beginning are reloaded
+	writeTestFile(t, dir, "a.csv", "x,y\n1,1\n2,2\n3,3\n4,4\n6,6\n", os.O_TRUNC)
+	checkEvent(t, handle(w, "a.csv", fsnotify.Write), ModifyState, []float64{1, 2, 3, 4, 6})
+
+	writeTestFile(t, dir, "a.csv", "x,y\n1,1\n", os.O_TRUNC)
+	checkEvent(t, handle(w, "a.csv", fsnotify.Write), ModifyState, []float64{1})
+
+	writeTestFile(t, dir, "a.csv", "x,y\n7,7\n8,8\n", os.O_TRUNC)
+	checkEvent(t, handle(w, "a.csv", fsnotify.Write), ModifyState, []float64{7, 8})
+
+	if err := os.Remove(filepath.Join(dir, "a.csv")); err != nil {
+		t.Fatalf("removing file failed: %v", err)
+	}
+
+	checkEvent(t, handle(w, "a.csv", fsnotify.Remove), RemoveState, nil)
+}
+
+func TestWatcherFileStateSkipsNotProcessedLines(t *testing.T) {
+	w, dir := newTestWatcher(t)
+	defer os.RemoveAll(dir)
+
+	// file, found on start, is read on the first request
+	writeTestFile(t, dir, "a.csv", "x,y\n1,1\n2,2\n", os.O_TRUNC)
+	w.files["a.csv"] = "a.csv"
+
+	data, err := w.FileState("a.csv")
+	if err != nil || !equalValues(data.X, []float64{1, 2}) {
+		t.Fatalf("unexpected file state %v: %v", data, err)
+	}
+
+	// lines, appended before the update is processed, are not read from disk even on cache miss
+	writeTestFile(t, dir, "a.csv", "3,3\n", os.O_APPEND)
+	w.cache.remove("a.csv")
+
+	data, err = w.FileState("a.csv")
+	if err != nil || !equalValues(data.X, []float64{1, 2}) {
+		t.Fatalf("unexpected file state %v: %v", data, err)
+	}
+
+	appended := handle(w, "a.csv", fsnotify.Write)
+	checkEvent(t, appended, AppendState, []float64{3})
+
+	if appended.Values.Version <= data.Version {
+		t.Fatalf("append version %d is not greater than %d", appended.Values.Version, data.Version)
+	}
+}
+
+func TestWatcherCompressedNameConflict(t *testing.T) {
+	w, dir := newTestWatcher(t)
+	defer os.RemoveAll(dir)
+
+	w.addFiles([]string{"b.csv.gz", "b.csv", "c.csv.zst", "c.csv.gz"})
+	if w.files["b.csv"] != "b.csv" || w.files["c.csv"] != "c.csv.gz" {
+		t.Fatalf("unexpected files on start: %v", w.files)
+	}
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("x,y\n2,2\n3,3\n"))
+	gz.Close()
+
+	writeTestFile(t, dir, "a.csv", "x,y\n1,1\n", os.O_TRUNC)
+	checkEvent(t, handle(w, "a.csv", fsnotify.Create), CreateState, []float64{1})
+
+	// compressed file is shadowed by the uncompressed one
+	writeTestFile(t, dir, "a.csv.gz", compressed.String(), os.O_TRUNC)
+	if event := handle(w, "a.csv.gz", fsnotify.Create); event != nil {
+		t.Fatalf("unexpected %s event of shadowed file", event.Type)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.csv")); err != nil {
+		t.Fatalf("removing file failed: %v", err)
+	}
+
+	checkEvent(t, handle(w, "a.csv", fsnotify.Remove), ModifyState, []float64{2, 3})
+
+	if w.files["a.csv"] != "a.csv.gz" {
+		t.Fatalf("expected a.csv.gz to be watched, got %q", w.files["a.csv"])
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.csv.gz")); err != nil {
+		t.Fatalf("removing file failed: %v", err)
+	}
+
+	checkEvent(t, handle(w, "a.csv.gz", fsnotify.Remove), RemoveState, nil)
+
+	if state := w.State(); len(state) != 2 {
+		t.Fatalf("expected only files, found on start, got %q", state)
+	}
+}
@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Window - keeps only the last points of the file data: last Points points and/or points with x within span
+// of the last x, it tracks x values of points in the window, so appended points move the window start
+type Window struct {
+	points int
+	span   float64
+
+	x []float64
+	sync.Mutex
+}
+
+// NewWindow - returns window of last points count and/or points with x not less than the last x - span
+func NewWindow(points int, span float64) (*Window, error) {
+	if points < 0 || span < 0 || math.IsNaN(span) || math.IsInf(span, 0) {
+		return nil, errors.New("bad window size")
+	}
+
+	if points == 0 && span == 0 {
+		return nil, errors.New("empty window")
+	}
+
+	return &Window{points: points, span: span}, nil
+}
+
+// Apply - returns points of the full file data, which are in the window, and the window start x,
+// start is NaN, if there are no points in the window
+func (w *Window) Apply(data *FileData) (*FileData, float64) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.x = w.x[:0]
+	return w.add(data)
+}
+
+// ApplyTail - returns appended points, which are in the window, and the new window start x,
+// clients should drop points with x less than the start
+func (w *Window) ApplyTail(tail *FileData) (*FileData, float64) {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.add(tail)
+}
+
+func (w *Window) add(data *FileData) (*FileData, float64) {
+	if data.Len() == 0 {
+		return data, w.start()
+	}
+
+	last := data.X[data.Len()-1]
+
+	indexes := make([]int, 0, data.Len())
+	for i, x := range data.X {
+		if w.span == 0 || x >= last-w.span {
+			indexes = append(indexes, i)
+		}
+	}
+
+	if w.points > 0 && len(indexes) > w.points {
+		indexes = indexes[len(indexes)-w.points:]
+	}
+
+	for _, i := range indexes {
+		w.x = append(w.x, data.X[i])
+	}
+
+	drop := 0
+	for drop < len(w.x) && (w.points > 0 && len(w.x)-drop > w.points || w.span > 0 && w.x[drop] < last-w.span) {
+		drop++
+	}
+
+	// dropped values are freed, when append reallocates the array
+	w.x = w.x[drop:]
+
+	if len(indexes) == data.Len() {
+		return data, w.start()
+	}
+
+	return data.pick(indexes), w.start()
+}
+
+// start - returns x of the first point in the window
+func (w *Window) start() float64 {
+	if len(w.x) == 0 {
+		return math.NaN()
+	}
+
+	return w.x[0]
+}
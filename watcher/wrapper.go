@@ -0,0 +1,41 @@
+package watcher
+
+// wrapper - watcher, which adds features to the inner watcher
+type wrapper interface {
+	Unwrap() Watcher
+}
+
+// AsVirtualFiles - returns watcher of the wrappers chain, which allows to define virtual files
+func AsVirtualFiles(w Watcher) (VirtualFiles, bool) {
+	for w != nil {
+		if files, ok := w.(VirtualFiles); ok {
+			return files, true
+		}
+
+		w = unwrap(w)
+	}
+
+	return nil, false
+}
+
+// AsAlerting - returns watcher of the wrappers chain, which evaluates alert rules
+func AsAlerting(w Watcher) (Alerting, bool) {
+	for w != nil {
+		if alerting, ok := w.(Alerting); ok {
+			return alerting, true
+		}
+
+		w = unwrap(w)
+	}
+
+	return nil, false
+}
+
+// unwrap - returns the inner watcher, returns nil, if w is not a wrapper
+func unwrap(w Watcher) Watcher {
+	if wrapper, ok := w.(wrapper); ok {
+		return wrapper.Unwrap()
+	}
+
+	return nil
+}
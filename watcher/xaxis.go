@@ -0,0 +1,119 @@
+package watcher
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+)
+
+const (
+	// NumberAxis - x values are plain numbers
+	NumberAxis = "number"
+
+	// TimeAxis - x values are epoch milliseconds
+	TimeAxis = "time"
+)
+
+// x values types of the XParser
+const (
+	autoXType    = "auto"
+	numberXType  = "number"
+	timeXType    = "time"
+	epochSXType  = "epoch_s"
+	epochMsXType = "epoch_ms"
+)
+
+// defaultTimeLayouts - layouts of time values, which are tried, if layouts are not configured
+var defaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// DefaultXParser - x parser, which is used, if file data has no parser set
+var DefaultXParser = &XParser{xType: autoXType, layouts: defaultTimeLayouts, location: time.UTC}
+
+// XParser - parses x values, time values are normalized to epoch milliseconds
+type XParser struct {
+	xType    string
+	layouts  []string
+	location *time.Location
+}
+
+// NewXParser - returns new x values parser
+func NewXParser(cfg config.XAxis) (*XParser, error) {
+	p := &XParser{xType: strings.ToLower(cfg.Type), layouts: cfg.Layouts, location: time.UTC}
+
+	switch p.xType {
+	case "":
+		p.xType = autoXType
+	case autoXType, numberXType, timeXType, epochSXType, epochMsXType:
+	default:
+		return nil, errors.Errorf("unknown x axis type %q", cfg.Type)
+	}
+
+	if len(p.layouts) == 0 {
+		p.layouts = defaultTimeLayouts
+	}
+
+	if cfg.Location != "" {
+		location, err := time.LoadLocation(cfg.Location)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading location %q failed", cfg.Location)
+		}
+
+		p.location = location
+	}
+
+	return p, nil
+}
+
+// Parse - returns x value and axis type of the value
+func (p *XParser) Parse(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+
+	switch p.xType {
+	case numberXType:
+		x, err := strconv.ParseFloat(s, 64)
+		return x, NumberAxis, err
+
+	case epochSXType, epochMsXType:
+		x, err := strconv.ParseFloat(s, 64)
+		if p.xType == epochSXType {
+			x *= 1000
+		}
+
+		return x, TimeAxis, err
+
+	case timeXType:
+		x, err := p.parseTime(s)
+		return x, TimeAxis, err
+	}
+
+	if x, err := strconv.ParseFloat(s, 64); err == nil {
+		return x, NumberAxis, nil
+	}
+
+	x, err := p.parseTime(s)
+	return x, TimeAxis, err
+}
+
+// parseTime - parses time by the first matching layout, values without zone offset are in the parser location
+func (p *XParser) parseTime(s string) (float64, error) {
+	for _, layout := range p.layouts {
+		t, err := time.ParseInLocation(layout, s, p.location)
+		if err == nil {
+			return float64(t.Unix())*1000 + float64(t.Nanosecond())/float64(time.Millisecond), nil
+		}
+	}
+
+	return 0, errors.Errorf("time %q does not match layouts", s)
+}
@@ -0,0 +1,399 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lillilli/logger"
+	"github.com/pkg/errors"
+
+	"github.com/lillilli/graphex/config"
+	"github.com/lillilli/graphex/watcher"
+)
+
+const (
+	// EventHeader - header with the webhook event type
+	EventHeader = "X-Graphex-Event"
+
+	// DeliveryHeader - header with the delivery id, it is the same for all retries of the delivery
+	DeliveryHeader = "X-Graphex-Delivery"
+
+	// SignatureHeader - header with HMAC-SHA256 of the body in the "sha256=<hex>" form
+	SignatureHeader = "X-Graphex-Signature"
+)
+
+// errQueueIsFull - error of the event, which did not fit to the endpoint queue
+var errQueueIsFull = errors.New("queue is full")
+
+// Dispatcher - sends watcher events to webhook endpoints
+type Dispatcher interface {
+	Start(ctx context.Context)
+	// Dispatch - queues the event for delivery, it does not block, so it could be used as watcher tee listener
+	Dispatch(event *watcher.Event)
+}
+
+type dispatcher struct {
+	// dropped - count of not queued dead letters, it is accessed atomically
+	dropped uint64
+
+	endpoints []*endpoint
+	client    *http.Client
+
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	deadLetterFile string
+	deadLetterLock sync.Mutex
+
+	// deadLetters - queue of events, which did not fit to the endpoint queue, they are written by separate goroutine,
+	// so Dispatch does not wait for the dead-letter file
+	deadLetters chan *rejected
+
+	log logger.Logger
+}
+
+// rejected - delivery, which did not fit to the endpoint queue
+type rejected struct {
+	endpoint *endpoint
+	delivery *delivery
+}
+
+// delivery - webhook request of the event to the endpoint
+type delivery struct {
+	ID      string
+	Event   string
+	Body    []byte
+	Created time.Time
+}
+
+// deadLetter - failed delivery, which is appended to the dead-letter file
+type deadLetter struct {
+	URL      string          `json:"url"`
+	Delivery string          `json:"delivery"`
+	Event    string          `json:"event"`
+	Payload  json.RawMessage `json:"payload"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Time     time.Time       `json:"time"`
+}
+
+// NewDispatcher - returns new webhook dispatcher instance, endpoints filters are validated
+func NewDispatcher(cfg config.Webhooks) (Dispatcher, error) {
+	d := &dispatcher{
+		client: &http.Client{Timeout: cfg.Timeout},
+
+		retries:    cfg.Retries,
+		minBackoff: cfg.MinBackoff,
+		maxBackoff: cfg.MaxBackoff,
+
+		deadLetterFile: cfg.DeadLetterFile,
+		log:            logger.NewLogger("webhooks"),
+	}
+
+	deadLettersSize := cfg.QueueSize
+	if deadLettersSize <= 0 {
+		deadLettersSize = 1
+	}
+
+	d.deadLetters = make(chan *rejected, deadLettersSize)
+
+	if d.minBackoff <= 0 {
+		d.minBackoff = time.Second
+	}
+
+	if d.maxBackoff < d.minBackoff {
+		d.maxBackoff = d.minBackoff
+	}
+
+	for _, endpointCfg := range cfg.Endpoints {
+		e, err := newEndpoint(endpointCfg, cfg.QueueSize)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating webhook endpoint %q failed", endpointCfg.URL)
+		}
+
+		d.endpoints = append(d.endpoints, e)
+	}
+
+	return d, nil
+}
+
+// Start - starts delivery workers, one for every endpoint, so endpoint events are delivered in order,
+// and writer of the rejected events dead letters
+func (d *dispatcher) Start(ctx context.Context) {
+	d.log.Infof("Starting with %d endpoints ...", len(d.endpoints))
+
+	for _, e := range d.endpoints {
+		go d.deliverEvents(ctx, e)
+	}
+
+	go d.writeDeadLetters(ctx)
+}
+
+func (d *dispatcher) Dispatch(event *watcher.Event) {
+	var payload []byte
+
+	for _, e := range d.endpoints {
+		if !e.accepts(event) {
+			continue
+		}
+
+		if payload == nil {
+			b, err := json.Marshal(newPayload(event))
+			if err != nil {
+				d.log.Errorf("Encoding webhook payload of %q failed: %v", event.Name, err)
+				return
+			}
+
+			payload = b
+		}
+
+		req := &delivery{ID: newDeliveryID(), Event: eventType(event), Body: payload, Created: time.Now()}
+
+		select {
+		case e.queue <- req:
+			continue
+		default:
+		}
+
+		select {
+		case d.deadLetters <- &rejected{endpoint: e, delivery: req}:
+		default:
+			atomic.AddUint64(&d.dropped, 1)
+		}
+	}
+}
+
+// writeDeadLetters - writes dead letters of the rejected events and reports count of the dropped ones,
+// queued dead letters are written, when dispatcher is stopped
+func (d *dispatcher) writeDeadLetters(ctx context.Context) {
+	for {
+		select {
+		case r := <-d.deadLetters:
+			d.deadLetter(r.endpoint, r.delivery, 0, errQueueIsFull)
+
+			if dropped := atomic.SwapUint64(&d.dropped, 0); dropped != 0 {
+				d.log.Errorf("%d events are dropped, as queues of endpoints and dead letters are full", dropped)
+			}
+
+		case <-ctx.Done():
+			for {
+				select {
+				case r := <-d.deadLetters:
+					d.deadLetter(r.endpoint, r.delivery, 0, errQueueIsFull)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (d *dispatcher) deliverEvents(ctx context.Context, e *endpoint) {
+	for {
+		select {
+		case req := <-e.queue:
+			d.deliver(ctx, e, req)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliver - sends the request to the endpoint, failed request is retried with exponential backoff
+// and is dead-lettered after the last retry
+func (d *dispatcher) deliver(ctx context.Context, e *endpoint, req *delivery) {
+	backoff := d.minBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := d.send(ctx, e, req)
+		if err == nil {
+			return
+		}
+
+		if attempt > d.retries {
+			d.deadLetter(e, req, attempt, err)
+			return
+		}
+
+		d.log.Warnf("Delivering %s to %q failed (attempt %d): %v", req.ID, e.url, attempt, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			d.deadLetter(e, req, attempt, errors.Wrap(ctx.Err(), "dispatcher is stopped"))
+			return
+		}
+
+		if backoff *= 2; backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
+}
+
+// send - posts the request to the endpoint, responses with not 2xx status codes are failures
+func (d *dispatcher) send(ctx context.Context, e *endpoint, req *delivery) error {
+	r, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(req.Body))
+	if err != nil {
+		return err
+	}
+
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(EventHeader, req.Event)
+	r.Header.Set(DeliveryHeader, req.ID)
+
+	if e.secret != "" {
+		r.Header.Set(SignatureHeader, Sign(e.secret, req.Body))
+	}
+
+	resp, err := d.client.Do(r)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// deadLetter - appends failed delivery to the dead-letter file as JSON line
+func (d *dispatcher) deadLetter(e *endpoint, req *delivery, attempts int, cause error) {
+	d.log.Errorf("Delivering %s to %q failed after %d attempts: %v", req.ID, e.url, attempts, cause)
+
+	if d.deadLetterFile == "" {
+		return
+	}
+
+	b, err := json.Marshal(&deadLetter{
+		URL: e.url, Delivery: req.ID, Event: req.Event, Payload: req.Body,
+		Attempts: attempts, Error: cause.Error(), Time: time.Now(),
+	})
+
+	if err != nil {
+		d.log.Errorf("Encoding dead letter failed: %v", err)
+		return
+	}
+
+	d.deadLetterLock.Lock()
+	defer d.deadLetterLock.Unlock()
+
+	if err := appendLine(d.deadLetterFile, b); err != nil {
+		d.log.Errorf("Writing dead letter failed: %v", err)
+	}
+}
+
+// Sign - returns signature of the body in the SignatureHeader format
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// endpoint - webhook URL with events filters and queue of not delivered events
+type endpoint struct {
+	url    string
+	secret string
+
+	events map[string]bool
+	files  []string
+
+	queue chan *delivery
+}
+
+func newEndpoint(cfg config.WebhookEndpoint, queueSize int) (*endpoint, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "bad url")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("bad url scheme %q", u.Scheme)
+	}
+
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+
+	e := &endpoint{url: cfg.URL, secret: cfg.Secret, files: cfg.Files, queue: make(chan *delivery, queueSize)}
+
+	if len(cfg.Events) != 0 {
+		e.events = make(map[string]bool)
+	}
+
+	for _, event := range cfg.Events {
+		switch event {
+		case watcher.CreateState, watcher.ModifyState, watcher.RemoveState, watcher.AlertState:
+			e.events[event] = true
+		default:
+			return nil, errors.Errorf("unknown event type %q", event)
+		}
+	}
+
+	for _, pattern := range cfg.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Errorf("bad file pattern %q", pattern)
+		}
+	}
+
+	return e, nil
+}
+
+// accepts - checks, if the event passes the endpoint filters
+func (e *endpoint) accepts(event *watcher.Event) bool {
+	if e.events != nil && !e.events[eventType(event)] {
+		return false
+	}
+
+	if len(e.files) == 0 {
+		return true
+	}
+
+	for _, pattern := range e.files {
+		if ok, _ := path.Match(pattern, event.Name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func appendLine(fileName string, b []byte) error {
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,434 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lillilli/graphex/config"
+	"github.com/lillilli/graphex/watcher"
+)
+
+// request - webhook request, received by the test receiver
+type request struct {
+	header http.Header
+	body   []byte
+	time   time.Time
+}
+
+// receiver - test webhook endpoint, which responds with the given status codes in turn,
+// the last status code is used for the rest requests
+type receiver struct {
+	*httptest.Server
+
+	statuses []int
+	requests chan *request
+
+	sync.Mutex
+}
+
+func newReceiver(statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, requests: make(chan *request, 100)}
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		r.Lock()
+		status := http.StatusOK
+		if len(r.statuses) != 0 {
+			status = r.statuses[0]
+		}
+
+		if len(r.statuses) > 1 {
+			r.statuses = r.statuses[1:]
+		}
+		r.Unlock()
+
+		w.WriteHeader(status)
+		r.requests <- &request{header: req.Header, body: body, time: time.Now()}
+	}))
+
+	return r
+}
+
+// next - returns the next received request, test fails, if there is no request during the timeout
+func (r *receiver) next(t *testing.T) *request {
+	t.Helper()
+
+	select {
+	case req := <-r.requests:
+		return req
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook request is not received")
+		return nil
+	}
+}
+
+// none - checks, that there are no more requests
+func (r *receiver) none(t *testing.T) {
+	t.Helper()
+
+	select {
+	case req := <-r.requests:
+		t.Fatalf("unexpected webhook request: %s", req.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func startDispatcher(t *testing.T, cfg config.Webhooks) (Dispatcher, context.CancelFunc) {
+	t.Helper()
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 10
+	}
+
+	d, err := NewDispatcher(cfg)
+	if err != nil {
+		t.Fatalf("creating dispatcher failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.Start(ctx)
+
+	return d, cancel
+}
+
+func decodePayload(t *testing.T, body []byte) *Payload {
+	t.Helper()
+
+	payload := &Payload{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		t.Fatalf("decoding payload %s failed: %v", body, err)
+	}
+
+	return payload
+}
+
+func TestEndpointAccepts(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		files  []string
+		event  *watcher.Event
+		ok     bool
+	}{
+		{name: "no filters", event: &watcher.Event{Type: watcher.CreateState, Name: "a.csv"}, ok: true},
+		{name: "event type", events: []string{watcher.RemoveState}, event: &watcher.Event{Type: watcher.RemoveState, Name: "a.csv"}, ok: true},
+		{name: "other event type", events: []string{watcher.RemoveState}, event: &watcher.Event{Type: watcher.CreateState, Name: "a.csv"}},
+		{name: "append as modify", events: []string{watcher.ModifyState}, event: &watcher.Event{Type: watcher.AppendState, Name: "a.csv"}, ok: true},
+		{name: "alert", events: []string{watcher.AlertState}, event: &watcher.Event{Type: watcher.AlertState, Name: "a.csv"}, ok: true},
+		{name: "file pattern", files: []string{"runs/*.csv"}, event: &watcher.Event{Type: watcher.ModifyState, Name: "runs/a.csv"}, ok: true},
+		{name: "star does not cross dirs", files: []string{"runs/*.csv"}, event: &watcher.Event{Type: watcher.ModifyState, Name: "runs/x/a.csv"}},
+		{name: "any of patterns", files: []string{"*.tsv", "runs/*"}, event: &watcher.Event{Type: watcher.ModifyState, Name: "runs/a.csv"}, ok: true},
+		{
+			name: "type and file", events: []string{watcher.CreateState}, files: []string{"*.csv"},
+			event: &watcher.Event{Type: watcher.ModifyState, Name: "a.csv"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e, err := newEndpoint(config.WebhookEndpoint{URL: "http://localhost", Events: test.events, Files: test.files}, 1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ok := e.accepts(test.event); ok != test.ok {
+				t.Fatalf("expected %v, got %v", test.ok, ok)
+			}
+		})
+	}
+}
+
+func TestNewDispatcherErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint config.WebhookEndpoint
+	}{
+		{name: "bad url scheme", endpoint: config.WebhookEndpoint{URL: "ftp://localhost"}},
+		{name: "bad url", endpoint: config.WebhookEndpoint{URL: "http://local host:port"}},
+		{name: "unknown event type", endpoint: config.WebhookEndpoint{URL: "http://localhost", Events: []string{"APPEND"}}},
+		{name: "bad file pattern", endpoint: config.WebhookEndpoint{URL: "http://localhost", Files: []string{"[a"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewDispatcher(config.Webhooks{Endpoints: []config.WebhookEndpoint{test.endpoint}}); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestDispatcherFilters(t *testing.T) {
+	r := newReceiver()
+	defer r.Close()
+
+	d, cancel := startDispatcher(t, config.Webhooks{Endpoints: []config.WebhookEndpoint{
+		{URL: r.URL, Events: []string{watcher.ModifyState, watcher.RemoveState}, Files: []string{"runs/*.csv"}},
+	}})
+	defer cancel()
+
+	d.Dispatch(&watcher.Event{Type: watcher.CreateState, Name: "runs/a.csv"})
+	d.Dispatch(&watcher.Event{Type: watcher.ModifyState, Name: "runs/a.csv", Values: &watcher.FileData{X: []float64{1, 2}, Version: 3}})
+	d.Dispatch(&watcher.Event{Type: watcher.AppendState, Name: "runs/b.csv", Values: &watcher.FileData{X: []float64{3}, Version: 4}})
+	d.Dispatch(&watcher.Event{Type: watcher.RemoveState, Name: "other/a.csv"})
+	d.Dispatch(&watcher.Event{Type: watcher.RemoveState, Name: "runs/c.csv"})
+
+	expected := []Payload{
+		{Type: watcher.ModifyState, File: "runs/a.csv", DataVersion: 3, Points: 2},
+		{Type: watcher.ModifyState, File: "runs/b.csv", DataVersion: 4, Points: 1, Appended: true},
+		{Type: watcher.RemoveState, File: "runs/c.csv"},
+	}
+
+	for _, e := range expected {
+		req := r.next(t)
+
+		if event := req.header.Get(EventHeader); event != e.Type {
+			t.Errorf("expected %s header %q, got %q", EventHeader, e.Type, event)
+		}
+
+		if req.header.Get(DeliveryHeader) == "" {
+			t.Errorf("%s header is not set", DeliveryHeader)
+		}
+
+		if signature := req.header.Get(SignatureHeader); signature != "" {
+			t.Errorf("unexpected %s header %q without secret", SignatureHeader, signature)
+		}
+
+		payload := decodePayload(t, req.body)
+		payload.Time = time.Time{}
+
+		if *payload != e {
+			t.Errorf("expected payload %+v, got %+v", e, *payload)
+		}
+	}
+
+	r.none(t)
+}
+
+func TestDispatcherSignature(t *testing.T) {
+	const secret = "secret"
+
+	r := newReceiver()
+	defer r.Close()
+
+	d, cancel := startDispatcher(t, config.Webhooks{Endpoints: []config.WebhookEndpoint{{URL: r.URL, Secret: secret}}})
+	defer cancel()
+
+	d.Dispatch(&watcher.Event{Type: watcher.CreateState, Name: "a.csv"})
+	req := r.next(t)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(req.body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if signature := req.header.Get(SignatureHeader); signature != expected {
+		t.Fatalf("expected %s header %q, got %q", SignatureHeader, expected, signature)
+	}
+
+	if signature := Sign(secret, req.body); signature != expected {
+		t.Fatalf("expected signature %q, got %q", expected, signature)
+	}
+
+	if signature := Sign("other", req.body); signature == expected {
+		t.Fatal("signature does not depend on the secret")
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	const minBackoff = 20 * time.Millisecond
+
+	r := newReceiver(http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent)
+	defer r.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	deadLetterFile := filepath.Join(dir, "dead.jsonl")
+
+	d, cancel := startDispatcher(t, config.Webhooks{
+		Endpoints:  []config.WebhookEndpoint{{URL: r.URL}},
+		Retries:    3,
+		MinBackoff: minBackoff,
+		MaxBackoff: 4 * minBackoff,
+
+		DeadLetterFile: deadLetterFile,
+	})
+	defer cancel()
+
+	d.Dispatch(&watcher.Event{Type: watcher.CreateState, Name: "a.csv"})
+
+	requests := []*request{r.next(t), r.next(t), r.next(t)}
+	r.none(t)
+
+	for i, req := range requests[1:] {
+		if id := req.header.Get(DeliveryHeader); id != requests[0].header.Get(DeliveryHeader) {
+			t.Errorf("retry %d: delivery id %q differs from %q", i+1, id, requests[0].header.Get(DeliveryHeader))
+		}
+
+		backoff := minBackoff << uint(i)
+		if interval := req.time.Sub(requests[i].time); interval < backoff {
+			t.Errorf("retry %d: expected backoff at least %s, got %s", i+1, backoff, interval)
+		}
+	}
+
+	if _, err := os.Stat(deadLetterFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no dead letters, got %v", err)
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	r := newReceiver(http.StatusServiceUnavailable)
+	defer r.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	deadLetterFile := filepath.Join(dir, "dead.jsonl")
+
+	d, cancel := startDispatcher(t, config.Webhooks{
+		Endpoints:  []config.WebhookEndpoint{{URL: r.URL}},
+		Retries:    2,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+
+		DeadLetterFile: deadLetterFile,
+	})
+	defer cancel()
+
+	d.Dispatch(&watcher.Event{Type: watcher.RemoveState, Name: "a.csv"})
+
+	id := r.next(t).header.Get(DeliveryHeader)
+	r.next(t)
+	r.next(t)
+	r.none(t)
+
+	b, err := ioutil.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatalf("reading dead-letter file failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(lines))
+	}
+
+	letter := &deadLetter{}
+	if err := json.Unmarshal([]byte(lines[0]), letter); err != nil {
+		t.Fatalf("decoding dead letter failed: %v", err)
+	}
+
+	if letter.URL != r.URL || letter.Delivery != id || letter.Event != watcher.RemoveState || letter.Attempts != 3 {
+		t.Errorf("unexpected dead letter %+v", letter)
+	}
+
+	if !strings.Contains(letter.Error, "503") {
+		t.Errorf("expected status in the dead letter error, got %q", letter.Error)
+	}
+
+	if payload := decodePayload(t, letter.Payload); payload.Type != watcher.RemoveState || payload.File != "a.csv" {
+		t.Errorf("unexpected dead letter payload %+v", payload)
+	}
+}
+
+func TestDispatcherQueueIsFull(t *testing.T) {
+	r := newReceiver()
+	defer r.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	deadLetterFile := filepath.Join(dir, "dead.jsonl")
+
+	// dispatcher is not started, so events stay in the queues
+	d, err := NewDispatcher(config.Webhooks{
+		Endpoints: []config.WebhookEndpoint{{URL: r.URL}},
+		Timeout:   time.Second,
+		QueueSize: 1,
+
+		DeadLetterFile: deadLetterFile,
+	})
+
+	if err != nil {
+		t.Fatalf("creating dispatcher failed: %v", err)
+	}
+
+	for _, name := range []string{"a.csv", "b.csv", "c.csv"} {
+		d.Dispatch(&watcher.Event{Type: watcher.CreateState, Name: name})
+	}
+
+	if _, err := os.Stat(deadLetterFile); !os.IsNotExist(err) {
+		t.Fatalf("expected dead letters to be written in background, got %v", err)
+	}
+
+	if dropped := d.(*dispatcher).dropped; dropped != 1 {
+		t.Fatalf("expected 1 dropped event, got %d", dropped)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d.Start(ctx)
+
+	if payload := decodePayload(t, r.next(t).body); payload.File != "a.csv" {
+		t.Errorf("expected delivery of a.csv, got %+v", payload)
+	}
+
+	b := waitFile(t, deadLetterFile)
+
+	letter := &deadLetter{}
+	if err := json.Unmarshal(b, letter); err != nil {
+		t.Fatalf("decoding dead letter failed: %v", err)
+	}
+
+	if payload := decodePayload(t, letter.Payload); payload.File != "b.csv" || letter.Attempts != 0 || letter.Error != "queue is full" {
+		t.Errorf("unexpected dead letter %+v with payload %+v", letter, payload)
+	}
+}
+
+// waitFile - returns content of the file, test fails, if the file is not written during the timeout
+func waitFile(t *testing.T, fileName string) []byte {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		b, err := ioutil.ReadFile(fileName)
+		if err == nil && len(b) != 0 {
+			return b
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("file %q is not written: %v", fileName, err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "graphex-webhook")
+	if err != nil {
+		t.Fatalf("creating temp dir failed: %v", err)
+	}
+
+	return dir
+}
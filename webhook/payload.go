@@ -0,0 +1,44 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/lillilli/graphex/watcher"
+)
+
+// Payload - JSON body of the webhook request
+type Payload struct {
+	Type string    `json:"type"`
+	File string    `json:"file"`
+	Time time.Time `json:"time"`
+
+	// DataVersion - version of the file data, Points - count of the file points (count of new points for appends)
+	DataVersion uint64 `json:"data_version,omitempty"`
+	Points      int    `json:"points,omitempty"`
+	// Appended - is set, if points are appended to the end of the file
+	Appended bool `json:"appended,omitempty"`
+
+	Alert *watcher.Alert `json:"alert,omitempty"`
+}
+
+// newPayload - returns payload of the watcher event, appends are sent as MODIFY events
+func newPayload(event *watcher.Event) *Payload {
+	payload := &Payload{Type: eventType(event), File: event.Name, Time: time.Now(), Alert: event.Alert}
+
+	if event.Values != nil {
+		payload.DataVersion = event.Values.Version
+		payload.Points = event.Values.Len()
+	}
+
+	payload.Appended = event.Type == watcher.AppendState
+	return payload
+}
+
+// eventType - returns webhook event type of the watcher event
+func eventType(event *watcher.Event) string {
+	if event.Type == watcher.AppendState {
+		return watcher.ModifyState
+	}
+
+	return event.Type
+}